@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/agents"
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/memory"
+)
+
+// agentHistoryMessages caps how much of conversationLog is replayed to the
+// agent as context on each turn.
+const agentHistoryMessages = 20
+
+// agentMaxIterations bounds the tool-use steps of one agent run.
+const agentMaxIterations = 5
+
+// Agent modes selected with --agent / AGENT_MODE.
+const (
+	agentModeReact = "react" // text-parsing ZeroShotReactDescription agent
+	agentModeTools = "tools" // native tool/function calling
+)
+
+// reactPromptSuffix is the default ZeroShotReactDescription suffix with the
+// conversation memory spliced in ahead of the question.
+const reactPromptSuffix = `Begin!
+
+Previous conversation history:
+{{.history}}
+
+Question: {{.input}}
+{{.agent_scratchpad}}`
+
+// newAgentExecutor builds a ReAct agent whose memory is seeded with history,
+// so earlier turns are real context for the next answer. A non-nil printer
+// receives the LLM's streamed output.
+func newAgentExecutor(session Session, history []llms.ChatMessage, printer *streamPrinter) (*agents.Executor, error) {
+	mem := memory.NewConversationBuffer(memory.WithChatHistory(
+		memory.NewChatMessageHistory(memory.WithPreviousMessages(recentHistory(history))),
+	))
+
+	opts := []agents.Option{
+		agents.WithMaxIterations(agentMaxIterations),
+		agents.WithMemory(mem),
+		agents.WithPromptSuffix(reactPromptSuffix),
+	}
+	if printer != nil {
+		opts = append(opts, agents.WithCallbacksHandler(printer))
+	}
+	return agents.Initialize(llmClient, agentToolRegistry.LangChainTools(session), agents.ZeroShotReactDescription, opts...)
+}
+
+// recentHistory trims history to the last agentHistoryMessages messages.
+func recentHistory(history []llms.ChatMessage) []llms.ChatMessage {
+	if len(history) > agentHistoryMessages {
+		return history[len(history)-agentHistoryMessages:]
+	}
+	return history
+}
+
+// askAgent runs one conversation turn: the agent sees conversationLog as
+// context, and on success the turn is appended to the log and persisted to
+// conversation_memory. The returned trace lists what the tools retrieved.
+//
+// With stream.Out set, the final answer is written there as it is generated
+// (followed by a newline); if the model never produced a streamable final
+// answer, the complete response is written once the run ends. Either way only
+// the final response is stored.
+func askAgent(ctx context.Context, session Session, prompt string, stream streamOptions) (string, *runTrace, error) {
+	response, streamed, trace, err := runAgentTurn(ctx, session, conversationLog, prompt, stream)
+	if streamed {
+		fmt.Fprintln(stream.Out)
+	}
+	if err != nil {
+		return "", trace, err
+	}
+	if stream.Out != nil && !streamed {
+		fmt.Fprintln(stream.Out, response)
+	}
+
+	conversationLog = append(conversationLog,
+		llms.HumanChatMessage{Content: prompt},
+		llms.AIChatMessage{Content: response},
+	)
+	return response, trace, nil
+}
+
+// runAgentTurn answers prompt with history as context, using the agent
+// selected by currentConfig.AgentMode, and stores the turn in
+// conversation_memory. It leaves conversationLog alone, so concurrent turns
+// (serve mode) are safe. streamed reports whether part of the answer was
+// written to stream.Out.
+func runAgentTurn(ctx context.Context, session Session, history []llms.ChatMessage, prompt string, stream streamOptions) (response string, streamed bool, trace *runTrace, err error) {
+	ctx, trace = withRunTrace(ctx)
+	if currentConfig.AgentMode == agentModeTools {
+		response, err = runToolAgent(ctx, session, history, prompt, stream)
+	} else {
+		response, streamed, err = runReactAgent(ctx, session, history, prompt, stream)
+	}
+	if err != nil {
+		return "", streamed, trace, err
+	}
+	storeConversationHistory(ctx, session, prompt, response)
+	return response, streamed, trace, nil
+}
+
+// runReactAgent answers prompt with the ReAct executor, streaming the final
+// answer to stream.Out when set. It reports whether anything was streamed.
+func runReactAgent(ctx context.Context, session Session, history []llms.ChatMessage, prompt string, stream streamOptions) (string, bool, error) {
+	var printer *streamPrinter
+	if stream.Out != nil {
+		printer = newStreamPrinter(stream)
+	}
+	executor, err := newAgentExecutor(session, history, printer)
+	if err != nil {
+		return "", false, fmt.Errorf("initializing agent: %w", err)
+	}
+	response, err := chains.Run(ctx, executor, prompt)
+	return response, printer != nil && printer.Streamed(), err
+}
+
+// turnMessages splits a stored "User: ...\nAssistant: ..." turn back into
+// chat messages.
+func turnMessages(text string) []llms.ChatMessage {
+	user, assistant, ok := strings.Cut(strings.TrimPrefix(text, "User: "), "\nAssistant: ")
+	if !ok {
+		return []llms.ChatMessage{llms.HumanChatMessage{Content: text}}
+	}
+	return []llms.ChatMessage{
+		llms.HumanChatMessage{Content: user},
+		llms.AIChatMessage{Content: assistant},
+	}
+}
+
+func formatChatMessage(m llms.ChatMessage) string {
+	if m.GetType() == llms.ChatMessageTypeAI {
+		return "Assistant: " + m.GetContent()
+	}
+	return "User: " + m.GetContent()
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// maxBatchLine is the longest input or output line batch mode reads.
+const maxBatchLine = 16 << 20
+
+// batchItem is one input line. Prompt may also be given as "body" and ID as
+// "request_id", so backlog-style files run as-is. Lines without an ID are
+// identified by their line number.
+type batchItem struct {
+	ID        string `json:"id"`
+	RequestID string `json:"request_id"`
+	Prompt    string `json:"prompt"`
+	Body      string `json:"body"`
+	Session   string `json:"session"`
+	User      string `json:"user"`
+	Expected  string `json:"expected"`
+}
+
+// session is the session the line runs in: its own session and user, or
+// those of defaults where it names none. Without a default session a line
+// that names none gets a session of its own, batch-<id>, so independent
+// prompts never see each other's turns.
+func (it batchItem) session(defaults Session) Session {
+	s := Session{ID: it.Session, UserID: it.User}
+	if s.ID == "" {
+		s.ID = defaults.ID
+	}
+	if s.ID == "" {
+		s.ID = "batch-" + it.ID
+	}
+	if s.UserID == "" {
+		s.UserID = defaults.UserID
+	}
+	return s
+}
+
+// batchResult is one output line.
+type batchResult struct {
+	ID            string   `json:"id"`
+	Session       string   `json:"session"`
+	Prompt        string   `json:"prompt"`
+	Response      string   `json:"response"`
+	Expected      string   `json:"expected,omitempty"`
+	ExpectedFound *bool    `json:"expected_found,omitempty"`
+	Tools         []string `json:"tools"`
+	Sources       []string `json:"sources"`
+	LatencyMS     int64    `json:"latency_ms"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// batchOptions configures runBatch. Session.UserID is used for lines that
+// do not name a user; Session.ID, if set, for lines that do not name a
+// session.
+type batchOptions struct {
+	InputPath   string
+	OutputPath  string
+	Concurrency int
+	Session     Session
+}
+
+// batchSummary reports what one batch run did.
+type batchSummary struct {
+	Output  string `json:"output"`
+	Written int    `json:"written"`
+	Failed  int    `json:"failed"`
+	Skipped int    `json:"skipped"`
+}
+
+// runBatch runs every prompt in a JSONL file through the agent and appends a
+// result line per prompt to the output file.
+//
+// Lines that name a session run in file order, one at a time, each seeing
+// the session's earlier turns as history; different sessions and lines
+// without a session run concurrently, up to Concurrency at once. IDs that
+// already have an error-free result in the output file are skipped, so an
+// interrupted batch resumes where it stopped; the failed results of IDs that
+// run again are removed first, so the file holds one line per ID. Runs cut
+// short by cancellation are not written and run again on resume.
+func runBatch(ctx context.Context, opts batchOptions) (*batchSummary, error) {
+	summary := &batchSummary{Output: opts.OutputPath}
+	items, err := readBatchItems(opts.InputPath)
+	if err != nil {
+		return summary, err
+	}
+	done, err := completedBatchIDs(opts.OutputPath)
+	if err != nil {
+		return summary, err
+	}
+
+	rerun := map[string]bool{}
+	for _, it := range items {
+		if !done[it.ID] {
+			rerun[it.ID] = true
+		}
+	}
+	if err := pruneBatchOutput(opts.OutputPath, rerun); err != nil {
+		return summary, err
+	}
+	out, err := os.OpenFile(opts.OutputPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return summary, err
+	}
+	defer out.Close()
+
+	// Group lines into units of work: one per named session and user (in
+	// file order), one per line otherwise.
+	var groups [][]batchItem
+	bySession := map[Session]int{}
+	for _, it := range items {
+		if done[it.ID] {
+			summary.Skipped++
+			continue
+		}
+		if it.Session == "" {
+			groups = append(groups, []batchItem{it})
+			continue
+		}
+		s := it.session(opts.Session)
+		i, ok := bySession[s]
+		if !ok {
+			i = len(groups)
+			bySession[s] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], it)
+	}
+	if summary.Skipped > 0 {
+		log.Printf("Skipping %d prompt(s) already completed in %s", summary.Skipped, opts.OutputPath)
+	}
+
+	var (
+		writeMu  sync.Mutex
+		writeErr error
+	)
+	write := func(r batchResult) {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if _, err := out.Write(append(line, '\n')); err != nil && writeErr == nil {
+			writeErr = fmt.Errorf("writing %s: %w", opts.OutputPath, err)
+		}
+		summary.Written++
+		if r.Error != "" {
+			summary.Failed++
+		}
+	}
+
+	concurrency := max(opts.Concurrency, 1)
+	work := make(chan []batchItem)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range work {
+				runBatchGroup(ctx, opts.Session, group, write)
+			}
+		}()
+	}
+	for _, g := range groups {
+		select {
+		case work <- g:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	log.Printf("Batch finished: %d result(s) written (%d with errors), %d skipped", summary.Written, summary.Failed, summary.Skipped)
+	if writeErr != nil {
+		return summary, writeErr
+	}
+	return summary, ctx.Err()
+}
+
+// runBatchGroup runs a group's prompts in order, carrying the conversation
+// from one to the next.
+func runBatchGroup(ctx context.Context, defaults Session, group []batchItem, write func(batchResult)) {
+	var history []llms.ChatMessage
+	if group[0].Session != "" {
+		s := group[0].session(defaults)
+		turns, err := listConversationHistory(ctx, HistoryOptions{Session: s, Last: agentHistoryMessages / 2})
+		if err != nil {
+			log.Printf("Warning: Failed to load history for session %s: %v", s.ID, err)
+		}
+		for _, t := range turns {
+			history = append(history, turnMessages(t.Text)...)
+		}
+	}
+
+	for _, it := range group {
+		if ctx.Err() != nil {
+			return
+		}
+		session := it.session(defaults)
+
+		start := time.Now()
+		response, _, trace, err := runAgentTurn(ctx, session, history, it.Prompt, streamOptions{})
+		if err != nil && ctx.Err() != nil {
+			return // interrupted; run again on resume
+		}
+
+		r := batchResult{
+			ID:        it.ID,
+			Session:   session.ID,
+			Prompt:    it.Prompt,
+			Response:  response,
+			Expected:  it.Expected,
+			Tools:     trace.Tools(),
+			Sources:   trace.SourceIDs(),
+			LatencyMS: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			if it.Expected != "" {
+				found := strings.Contains(strings.ToLower(response), strings.ToLower(it.Expected))
+				r.ExpectedFound = &found
+			}
+			history = append(history, llms.HumanChatMessage{Content: it.Prompt}, llms.AIChatMessage{Content: response})
+		}
+		write(r)
+	}
+}
+
+// readBatchItems parses the input file, skipping blank lines. IDs must be
+// unique, since they are what resuming matches on.
+func readBatchItems(path string) ([]batchItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []batchItem
+	seen := map[string]int{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), maxBatchLine)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var it batchItem
+		if err := json.Unmarshal([]byte(line), &it); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, n, err)
+		}
+		if it.ID == "" {
+			it.ID = it.RequestID
+		}
+		if it.ID == "" {
+			it.ID = fmt.Sprintf("line-%d", n)
+		}
+		if it.Prompt == "" {
+			it.Prompt = it.Body
+		}
+		if strings.TrimSpace(it.Prompt) == "" {
+			return nil, fmt.Errorf("%s line %d: prompt is required", path, n)
+		}
+		if prev, ok := seen[it.ID]; ok {
+			return nil, fmt.Errorf("%s line %d: id %q already used on line %d", path, n, it.ID, prev)
+		}
+		seen[it.ID] = n
+		items = append(items, it)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return items, nil
+}
+
+// completedBatchIDs returns the IDs with an error-free result in an existing
+// output file. A missing file means nothing is done yet; a torn last line
+// from a crash is ignored.
+func completedBatchIDs(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), maxBatchLine)
+	for sc.Scan() {
+		var r batchResult
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.Error == "" {
+			done[r.ID] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return done, nil
+}
+
+// pruneBatchOutput rewrites an existing output file without the results of
+// the IDs in rerun, which are about to get new ones, and without lines that
+// do not parse, such as a torn last line from a crash. The file is replaced
+// atomically (temp file + rename) and left alone if nothing is dropped and
+// it ends in a newline, so appended results always start a line.
+func pruneBatchOutput(path string, rerun map[string]bool) error {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var kept bytes.Buffer
+	dropped := 0
+	for _, line := range bytes.SplitAfter(raw, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var r batchResult
+		if err := json.Unmarshal(line, &r); err != nil || rerun[r.ID] {
+			dropped++
+			continue
+		}
+		kept.Write(bytes.TrimRight(line, "\n"))
+		kept.WriteByte('\n')
+	}
+	if dropped == 0 && (len(raw) == 0 || raw[len(raw)-1] == '\n') {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".batch-*.jsonl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(kept.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("rewriting %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if dropped > 0 {
+		log.Printf("Removed %d superseded or unreadable line(s) from %s", dropped, path)
+	}
+	return os.Rename(tmp.Name(), path)
+}
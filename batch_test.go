@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCompletedBatchIDs(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		missing bool
+		want    []string
+	}{
+		{name: "missing file", missing: true},
+		{
+			name:    "errors are not done",
+			content: `{"id":"a","response":"ok"}` + "\n" + `{"id":"b","error":"boom"}` + "\n",
+			want:    []string{"a"},
+		},
+		{
+			name:    "torn last line",
+			content: `{"id":"a","response":"ok"}` + "\n" + `{"id":"b","respo`,
+			want:    []string{"a"},
+		},
+		{
+			name:    "retried after an error",
+			content: `{"id":"a","error":"boom"}` + "\n" + `{"id":"a","response":"ok"}` + "\n",
+			want:    []string{"a"},
+		},
+	}
+	for _, tc := range cases {
+		path := filepath.Join(t.TempDir(), "out.jsonl")
+		if !tc.missing {
+			if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		done, err := completedBatchIDs(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var got []string
+		for id := range done {
+			got = append(got, id)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Fatalf("%s: done = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPruneBatchOutput(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		rerun   []string
+		want    string
+	}{
+		{
+			name:    "nothing to drop",
+			content: `{"id":"a"}` + "\n",
+			want:    `{"id":"a"}` + "\n",
+		},
+		{
+			name:    "failed result of a rerun ID",
+			content: `{"id":"a"}` + "\n" + `{"id":"b","error":"boom"}` + "\n" + `{"id":"c"}` + "\n",
+			rerun:   []string{"b"},
+			want:    `{"id":"a"}` + "\n" + `{"id":"c"}` + "\n",
+		},
+		{
+			name:    "torn last line",
+			content: `{"id":"a"}` + "\n" + `{"id":"b","resp`,
+			rerun:   []string{"b"},
+			want:    `{"id":"a"}` + "\n",
+		},
+		{
+			name:    "missing final newline",
+			content: `{"id":"a"}`,
+			want:    `{"id":"a"}` + "\n",
+		},
+	}
+	for _, tc := range cases {
+		path := filepath.Join(t.TempDir(), "out.jsonl")
+		if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		rerun := map[string]bool{}
+		for _, id := range tc.rerun {
+			rerun[id] = true
+		}
+		if err := pruneBatchOutput(path, rerun); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Fatalf("%s: file = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if err := pruneBatchOutput(filepath.Join(t.TempDir(), "none.jsonl"), nil); err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+}
+
+func TestBatchItemSession(t *testing.T) {
+	cases := []struct {
+		item     batchItem
+		defaults Session
+		want     Session
+	}{
+		{batchItem{ID: "q1"}, Session{UserID: "ada"}, Session{ID: "batch-q1", UserID: "ada"}},
+		{batchItem{ID: "q1"}, Session{ID: "trip", UserID: "ada"}, Session{ID: "trip", UserID: "ada"}},
+		{batchItem{ID: "q1", Session: "s", User: "bo"}, Session{ID: "trip", UserID: "ada"}, Session{ID: "s", UserID: "bo"}},
+		{batchItem{ID: "line-3", User: "bo"}, Session{}, Session{ID: "batch-line-3", UserID: "bo"}},
+	}
+	for _, tc := range cases {
+		if got := tc.item.session(tc.defaults); got != tc.want {
+			t.Fatalf("%+v.session(%+v) = %+v, want %+v", tc.item, tc.defaults, got, tc.want)
+		}
+	}
+}
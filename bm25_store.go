@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// BM25 indexes are persisted per collection as a gob-encoded, versioned file
+// in RAG_STATE_DIR. Only the documents are stored; term statistics are
+// recomputed on load, which is cheap compared to re-reading Chroma.
+
+// Version 2 adds the ID-set fingerprint.
+const bm25FileVersion = 2
+
+var errBM25FileVersion = errors.New("unsupported BM25 index file version")
+
+type bm25File struct {
+	Version    int
+	Collection string
+	// Fingerprint is idSetFingerprint of the documents' IDs; on load it is
+	// compared against the IDs in Chroma.
+	Fingerprint string
+	Docs        []BM25Doc
+}
+
+// idSetFingerprint hashes a set of IDs independently of their order, so two
+// collections with the same number of records but different ones differ.
+func idSetFingerprint(ids []string) string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, id := range sorted {
+		h.Write([]byte(id))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// docIDs returns the IDs of docs.
+func docIDs(docs []BM25Doc) []string {
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+func bm25IndexPath(collection string) string {
+	return filepath.Join(currentConfig.StateDir, "bm25_"+collection+".gob")
+}
+
+// Save writes the index documents to path atomically.
+func (idx *BM25Index) Save(path, collection string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating index directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".bm25-*.gob")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	docs := idx.Docs()
+	f := bm25File{Version: bm25FileVersion, Collection: collection, Fingerprint: idSetFingerprint(docIDs(docs)), Docs: docs}
+	if err := gob.NewEncoder(tmp).Encode(&f); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encoding BM25 index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadBM25Index reads an index written by Save, along with the fingerprint
+// of its ID set.
+func LoadBM25Index(path string) (*BM25Index, string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer fh.Close()
+
+	var f bm25File
+	if err := gob.NewDecoder(fh).Decode(&f); err != nil {
+		return nil, "", fmt.Errorf("decoding BM25 index %s: %w", path, err)
+	}
+	if f.Version != bm25FileVersion {
+		return nil, "", fmt.Errorf("%s: %w %d", path, errBM25FileVersion, f.Version)
+	}
+	return NewBM25Index(f.Docs), f.Fingerprint, nil
+}
+
+// rebuildBM25FromChroma builds an index over every document currently stored
+// in c, so lexical retrieval covers the same chunks as vector retrieval.
+func rebuildBM25FromChroma(ctx context.Context, c chroma.Collection) (*BM25Index, error) {
+	var docs []BM25Doc
+	err := chromaForEach(ctx, c, nil, func(id, doc string, _ map[string]interface{}) error {
+		docs = append(docs, BM25Doc{ID: id, Text: doc})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewBM25Index(docs), nil
+}
+
+// saveBM25Index persists idx as the index for c, logging rather than failing:
+// a missing or stale file only costs a rebuild on the next start.
+func saveBM25Index(idx *BM25Index, c chroma.Collection) {
+	if idx == nil || c == nil {
+		return
+	}
+	if err := idx.Save(bm25IndexPath(c.Name()), c.Name()); err != nil {
+		log.Printf("Warning: failed to save BM25 index for %s: %v", c.Name(), err)
+	}
+}
+
+// bm25FlushInterval is how often serve writes out indexes changed since the
+// last write.
+const bm25FlushInterval = time.Minute
+
+// Indexes updated on the request path (a stored conversation turn, an API
+// ingest) are only marked dirty: saving rewrites every document in the
+// index, which is too much to do per turn. Dirty indexes are written when
+// the runtime is released and periodically by serve; if the process dies in
+// between, loadOrRebuildBM25 sees the saved IDs no longer match Chroma and
+// rebuilds.
+var (
+	bm25DirtyMu sync.Mutex
+	bm25Dirty   = map[string]chroma.Collection{}
+)
+
+// markBM25Dirty records that the index for c has changes not yet saved.
+func markBM25Dirty(c chroma.Collection) {
+	if c == nil {
+		return
+	}
+	bm25DirtyMu.Lock()
+	defer bm25DirtyMu.Unlock()
+	bm25Dirty[c.Name()] = c
+}
+
+// flushBM25Indexes saves every index marked dirty.
+func flushBM25Indexes() {
+	bm25DirtyMu.Lock()
+	dirty := bm25Dirty
+	bm25Dirty = map[string]chroma.Collection{}
+	bm25DirtyMu.Unlock()
+
+	for _, c := range dirty {
+		saveBM25Index(lexicalIndex(c), c)
+	}
+}
+
+// loadOrRebuildBM25 returns the persisted index for c. It rebuilds from Chroma
+// (and saves the result) when rebuild is set, when no usable file exists, or
+// when the file's documents are no longer the collection's: a different
+// count, or the same count but a different set of IDs. Checking the IDs
+// pages through the collection without fetching documents, so a record
+// rewritten in place under the same ID by another writer is not detected.
+func loadOrRebuildBM25(ctx context.Context, c chroma.Collection, rebuild bool) (*BM25Index, error) {
+	if c == nil {
+		return nil, fmt.Errorf("collection is nil")
+	}
+	path := bm25IndexPath(c.Name())
+
+	if !rebuild {
+		idx, fingerprint, err := LoadBM25Index(path)
+		switch {
+		case err == nil:
+			n, cerr := c.Count(ctx)
+			if cerr != nil {
+				log.Printf("Warning: counting %s, using saved BM25 index: %v", c.Name(), cerr)
+				return idx, nil
+			}
+			if n != idx.Len() {
+				break
+			}
+			ids, lerr := chromaListIDs(ctx, c)
+			if lerr != nil {
+				log.Printf("Warning: listing %s, using saved BM25 index: %v", c.Name(), lerr)
+				return idx, nil
+			}
+			if idSetFingerprint(ids) == fingerprint {
+				return idx, nil
+			}
+		case !os.IsNotExist(err):
+			log.Printf("Warning: ignoring BM25 index file: %v", err)
+		}
+	}
+
+	idx, err := rebuildBM25FromChroma(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("rebuilding BM25 index for %s: %w", c.Name(), err)
+	}
+	saveBM25Index(idx, c)
+	log.Printf("Rebuilt BM25 index for %s (%d docs)", c.Name(), idx.Len())
+	return idx, nil
+}
+
+// loadLexicalIndex loads (or rebuilds) the BM25 index for c and registers it
+// for hybrid retrieval. On failure an empty index is registered so retrieval
+// and incremental updates keep working; it is rebuilt on the next start.
+func loadLexicalIndex(ctx context.Context, c chroma.Collection) error {
+	idx, err := loadOrRebuildBM25(ctx, c, false)
+	if err != nil {
+		setLexicalIndex(c, NewBM25Index(nil))
+		return err
+	}
+	setLexicalIndex(c, idx)
+	return nil
+}
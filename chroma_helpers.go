@@ -2,14 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"sort"
-	"strings"
 
 	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
 	"github.com/amikos-tech/chroma-go/pkg/embeddings"
 )
 
+// chromaPageSize bounds how many records a single paged Get fetches.
+const chromaPageSize = 500
+
 func chromaUpsert(ctx context.Context, c chroma.Collection, id string, doc string, embeddingVec []float32, metadata map[string]interface{}) error {
 	if c == nil {
 		return fmt.Errorf("collection is nil")
@@ -21,45 +23,63 @@ func chromaUpsert(ctx context.Context, c chroma.Collection, id string, doc strin
 		return fmt.Errorf("nil embedding")
 	}
 
-	emb := embeddings.Embedding(embeddingVec)
+	emb := embeddings.NewEmbeddingFromFloat32(embeddingVec)
+	md, err := chroma.NewDocumentMetadataFromMap(metadata)
+	if err != nil {
+		return fmt.Errorf("building metadata: %w", err)
+	}
 
-	_, err := c.Upsert(
+	return c.Upsert(
 		ctx,
-		[]string{id},
-		[]embeddings.Embedding{emb},
-		[]map[string]interface{}{metadata},
-		[]string{doc},
+		chroma.WithIDs(chroma.DocumentID(id)),
+		chroma.WithEmbeddings(emb),
+		chroma.WithMetadatas(md),
+		chroma.WithTexts(doc),
 	)
-	return err
 }
 
-func chromaQuery(ctx context.Context, c chroma.Collection, queryEmbedding []float32, k int) (ids []string, docs []string, metas []map[string]interface{}, err error) {
+// chromaQuery returns the k nearest records to queryEmbedding, nearest
+// first, with their distances in the collection's metric.
+func chromaQuery(ctx context.Context, c chroma.Collection, queryEmbedding []float32, k int, where chroma.WhereFilter) (ids []string, docs []string, metas []map[string]interface{}, distances []float64, err error) {
 	if c == nil {
-		return nil, nil, nil, fmt.Errorf("collection is nil")
+		return nil, nil, nil, nil, fmt.Errorf("collection is nil")
 	}
 	if k <= 0 {
 		k = 3
 	}
 
-	q := embeddings.Embedding(queryEmbedding)
-	res, err := c.Query(ctx, []embeddings.Embedding{q}, k, nil, nil, nil)
+	q := embeddings.NewEmbeddingFromFloat32(queryEmbedding)
+	opts := []chroma.CollectionQueryOption{
+		chroma.WithQueryEmbeddings(q),
+		chroma.WithNResults(k),
+		chroma.WithIncludeQuery(chroma.IncludeDocuments, chroma.IncludeMetadatas, chroma.IncludeDistances),
+	}
+	if where != nil {
+		opts = append(opts, chroma.WithWhereQuery(where))
+	}
+	res, err := c.Query(ctx, opts...)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	// chroma-go returns nested results (per query)
-	if len(res.IDs) == 0 {
-		return []string{}, []string{}, []map[string]interface{}{}, nil
+	if len(res.GetIDGroups()) == 0 {
+		return []string{}, []string{}, []map[string]interface{}{}, []float64{}, nil
 	}
 
-	ids = res.IDs[0]
-	if len(res.Documents) > 0 {
-		docs = res.Documents[0]
+	ids = documentIDStrings(res.GetIDGroups()[0])
+	if groups := res.GetDocumentsGroups(); len(groups) > 0 {
+		docs = documentStrings(groups[0])
 	}
-	if len(res.Metadatas) > 0 {
-		metas = res.Metadatas[0]
+	if groups := res.GetMetadatasGroups(); len(groups) > 0 {
+		metas = metadataMaps(groups[0])
 	}
-	return ids, docs, metas, nil
+	if groups := res.GetDistancesGroups(); len(groups) > 0 {
+		for _, d := range groups[0] {
+			distances = append(distances, float64(d))
+		}
+	}
+	return ids, docs, metas, distances, nil
 }
 
 func chromaGetByIDs(ctx context.Context, c chroma.Collection, ids []string) ([]Retrieved, error) {
@@ -70,22 +90,35 @@ func chromaGetByIDs(ctx context.Context, c chroma.Collection, ids []string) ([]R
 		return []Retrieved{}, nil
 	}
 
-	getRes, err := c.Get(ctx, ids, nil, nil, nil)
+	docIDs := make([]chroma.DocumentID, len(ids))
+	for i, id := range ids {
+		docIDs[i] = chroma.DocumentID(id)
+	}
+	getRes, err := c.Get(
+		ctx,
+		chroma.WithIDsGet(docIDs...),
+		chroma.WithIncludeGet(chroma.IncludeDocuments, chroma.IncludeMetadatas),
+	)
 	if err != nil {
 		return nil, err
 	}
 
 	// `Get` returns flat arrays aligned by ID order provided.
-	out := make([]Retrieved, 0, len(getRes.IDs))
-	for i := range getRes.IDs {
+	resIDs := documentIDStrings(getRes.GetIDs())
+	docs := documentStrings(getRes.GetDocuments())
+	metas := metadataMaps(getRes.GetMetadatas())
+
+	out := make([]Retrieved, 0, len(resIDs))
+	for i := range resIDs {
 		r := Retrieved{
-			ID: getRes.IDs[i],
+			ID: resIDs[i],
 		}
-		if i < len(getRes.Documents) {
-			r.Text = getRes.Documents[i]
+		if i < len(docs) {
+			r.Text = docs[i]
 		}
-		if i < len(getRes.Metadatas) {
-			if s, ok := getRes.Metadatas[i]["source"]; ok {
+		if i < len(metas) {
+			r.Meta = metas[i]
+			if s, ok := metas[i]["source"]; ok {
 				r.Source = fmt.Sprintf("%v", s)
 			}
 		}
@@ -95,31 +128,137 @@ func chromaGetByIDs(ctx context.Context, c chroma.Collection, ids []string) ([]R
 	return out, nil
 }
 
-func loadRecentConversationHistory(ctx context.Context, k int) ([]string, error) {
-	if conversationCollection == nil {
-		return []string{}, nil
+// chromaGetPage fetches one page of records from c, optionally restricted by
+// where. Chroma has no ordering guarantee beyond being stable between calls,
+// so callers that need an order must sort the results themselves.
+func chromaGetPage(ctx context.Context, c chroma.Collection, where chroma.WhereFilter, limit, offset int) (ids []string, docs []string, metas []map[string]interface{}, err error) {
+	if c == nil {
+		return nil, nil, nil, fmt.Errorf("collection is nil")
+	}
+	if limit <= 0 {
+		limit = chromaPageSize
+	}
+
+	opts := []chroma.CollectionGetOption{
+		chroma.WithIncludeGet(chroma.IncludeDocuments, chroma.IncludeMetadatas),
+		chroma.WithLimitGet(limit),
+		chroma.WithOffsetGet(offset),
 	}
-	if k <= 0 {
-		k = 20
+	if where != nil {
+		opts = append(opts, chroma.WithWhereGet(where))
 	}
 
-	// Pragmatic memory fetch: semantic query against a generic phrase.
-	// This keeps the system simple while ensuring stored conversation turns are retrievable later.
-	results, err := vectorRetrieve(ctx, conversationCollection, "conversation history", k)
+	res, err := c.Get(ctx, opts...)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
+	return documentIDStrings(res.GetIDs()), documentStrings(res.GetDocuments()), metadataMaps(res.GetMetadatas()), nil
+}
 
-	out := make([]string, 0, len(results))
-	for _, r := range results {
-		t := strings.TrimSpace(r.Text)
-		if t == "" {
-			continue
+// chromaForEach pages through every record in c matching where and calls fn
+// for each one. Iteration stops at the first error returned by fn.
+func chromaForEach(ctx context.Context, c chroma.Collection, where chroma.WhereFilter, fn func(id, doc string, meta map[string]interface{}) error) error {
+	for offset := 0; ; offset += chromaPageSize {
+		ids, docs, metas, err := chromaGetPage(ctx, c, where, chromaPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("paging collection at offset %d: %w", offset, err)
+		}
+		for i, id := range ids {
+			var doc string
+			if i < len(docs) {
+				doc = docs[i]
+			}
+			meta := map[string]interface{}{}
+			if i < len(metas) && metas[i] != nil {
+				meta = metas[i]
+			}
+			if err := fn(id, doc, meta); err != nil {
+				return err
+			}
+		}
+		if len(ids) < chromaPageSize {
+			return nil
 		}
-		out = append(out, t)
 	}
+}
 
-	// Provide stable output ordering across runs.
-	sort.Strings(out)
-	return out, nil
-}
\ No newline at end of file
+// chromaListIDs returns the ID of every record in c, paging without
+// fetching documents, metadata or embeddings.
+func chromaListIDs(ctx context.Context, c chroma.Collection) ([]string, error) {
+	if c == nil {
+		return nil, fmt.Errorf("collection is nil")
+	}
+	var all []string
+	for offset := 0; ; offset += chromaPageSize {
+		res, err := c.Get(ctx,
+			chroma.WithIncludeGet(),
+			chroma.WithLimitGet(chromaPageSize),
+			chroma.WithOffsetGet(offset),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("paging collection at offset %d: %w", offset, err)
+		}
+		ids := documentIDStrings(res.GetIDs())
+		all = append(all, ids...)
+		if len(ids) < chromaPageSize {
+			return all, nil
+		}
+	}
+}
+
+// chromaDeleteIDs removes ids from c in page-sized batches.
+func chromaDeleteIDs(ctx context.Context, c chroma.Collection, ids []string) error {
+	if c == nil {
+		return fmt.Errorf("collection is nil")
+	}
+	for i := 0; i < len(ids); i += chromaPageSize {
+		j := i + chromaPageSize
+		if j > len(ids) {
+			j = len(ids)
+		}
+		docIDs := make([]chroma.DocumentID, 0, j-i)
+		for _, id := range ids[i:j] {
+			docIDs = append(docIDs, chroma.DocumentID(id))
+		}
+		if err := c.Delete(ctx, chroma.WithIDsDelete(docIDs...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func documentIDStrings(ids chroma.DocumentIDs) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = string(id)
+	}
+	return out
+}
+
+func documentStrings(docs chroma.Documents) []string {
+	out := make([]string, len(docs))
+	for i, d := range docs {
+		if d != nil {
+			out[i] = d.ContentString()
+		}
+	}
+	return out
+}
+
+// metadataMaps flattens chroma metadata into plain maps via its JSON form,
+// so numbers come back as float64.
+func metadataMaps(metas chroma.DocumentMetadatas) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(metas))
+	for i, m := range metas {
+		out[i] = map[string]interface{}{}
+		if m == nil {
+			continue
+		}
+		raw, err := json.Marshal(m)
+		if err != nil {
+			continue
+		}
+		_ = json.Unmarshal(raw, &out[i])
+	}
+	return out
+}
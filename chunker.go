@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Chunker splits the text of one document section into chunks to embed.
+// A non-empty heading (such as a Markdown heading path) starts every chunk
+// on a line of its own and counts toward the chunk's size.
+type Chunker interface {
+	Chunk(heading, text string) []string
+	// Signature identifies the chunker and its settings. The ingestion
+	// manifest records it, so changing any of them re-indexes every file.
+	Signature() string
+}
+
+const (
+	chunkerTokens    = "tokens"
+	chunkerParagraph = "paragraph"
+)
+
+// ragChunker chunks everything ingested into rag_docs; initRuntime sets it up
+// from the CHUNK* settings. It stays nil, and ragChunkerErr says why, when
+// the configured tokenizer cannot be loaded.
+var (
+	ragChunker    Chunker
+	ragChunkerErr error
+)
+
+// minChunkTokens is the smallest CHUNK_TOKENS accepted. Below it a heading
+// gets no room, and long words are cut into a chunk each.
+const minChunkTokens = 32
+
+// newChunkerFromConfig builds the CHUNKER chunker. The token chunker's
+// budget is CHUNK_TOKENS, capped at the embedding model's maximum sequence
+// length less the [CLS] and [SEP] tokens; text past that limit would be
+// silently truncated by the model. It fails if the tokenizer or the limit
+// cannot be loaded.
+func newChunkerFromConfig(ctx context.Context) (Chunker, error) {
+	cfg := currentConfig
+	switch cfg.Chunker {
+	case chunkerParagraph:
+		return paragraphChunker{size: cfg.ChunkLength}, nil
+	case chunkerTokens, "":
+	default:
+		log.Printf("Warning: Unknown CHUNKER %q, using %s", cfg.Chunker, chunkerTokens)
+	}
+
+	tok, err := newTokenizer(ctx, cfg.ChunkTokenizer, cfg.EmbedModelName)
+	if err != nil {
+		return nil, err
+	}
+	seqLen, err := modelMaxSeqLength(ctx, cfg.EmbedModelName)
+	if err != nil {
+		return nil, err
+	}
+	limit := seqLen - 2
+	maxTokens := cfg.ChunkTokens
+	if maxTokens > limit {
+		log.Printf("Warning: CHUNK_TOKENS=%d exceeds what %s embeds, using %d", maxTokens, cfg.EmbedModelName, limit)
+	}
+	if maxTokens <= 0 || maxTokens > limit {
+		maxTokens = limit
+	}
+	if maxTokens < minChunkTokens {
+		log.Printf("Warning: CHUNK_TOKENS=%d is below the minimum, using %d", maxTokens, minChunkTokens)
+		maxTokens = minChunkTokens
+	}
+	overlap := max(cfg.ChunkOverlap, 0)
+	if overlap >= maxTokens {
+		log.Printf("Warning: CHUNK_OVERLAP=%d is not below the chunk size %d, using %d", overlap, maxTokens, maxTokens/4)
+		overlap = maxTokens / 4
+	}
+	return &tokenChunker{tok: tok, maxTokens: maxTokens, overlap: overlap}, nil
+}
+
+// ------------------
+// Token chunker
+// ------------------
+
+// tokenChunker packs whole sentences into chunks of at most maxTokens tokens
+// and starts each chunk with up to overlap tokens of trailing sentences from
+// the one before, so a passage on a boundary is whole in at least one chunk.
+// Chunks are verbatim slices of the input.
+type tokenChunker struct {
+	tok       Tokenizer
+	maxTokens int
+	overlap   int
+}
+
+func (c *tokenChunker) Signature() string {
+	return fmt.Sprintf("%s:%s:%d:%d", chunkerTokens, c.tok.Name(), c.maxTokens, c.overlap)
+}
+
+// textSpan is a byte range of the text being chunked and its token count.
+type textSpan struct {
+	start, end, tokens int
+}
+
+// Breaks tried in order on a piece of text. A sentence ends at terminal
+// punctuation (and any closing quotes or brackets) followed by whitespace;
+// sentences are the packing unit, and only a sentence too long for one chunk
+// is broken further, at line breaks, then between words.
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t]*\n\s*`)
+	sentenceBreak  = regexp.MustCompile(`[.!?…。]["'”’)\]]*(\s+)`)
+	lineBreak      = regexp.MustCompile(`\n\s*`)
+	wordBreak      = regexp.MustCompile(`\s+`)
+)
+
+// maxHeadingShare is the largest part of a chunk a heading may take; longer
+// heading paths lose their outer levels, and a heading still too long is
+// left out.
+const maxHeadingShare = 4
+
+func (c *tokenChunker) Chunk(heading, text string) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	heading = strings.TrimSpace(heading)
+	if heading == "" {
+		return c.chunk(text)
+	}
+
+	n := c.tok.Count(heading)
+	for n > c.maxTokens/maxHeadingShare {
+		i := strings.Index(heading, headingSep)
+		if i < 0 {
+			return c.chunk(text)
+		}
+		heading = heading[i+len(headingSep):]
+		n = c.tok.Count(heading)
+	}
+	sub := *c
+	sub.maxTokens -= n
+	if sub.overlap >= sub.maxTokens {
+		sub.overlap = sub.maxTokens / maxHeadingShare
+	}
+	chunks := sub.chunk(text)
+	for i := range chunks {
+		chunks[i] = heading + "\n" + chunks[i]
+	}
+	return chunks
+}
+
+// chunk packs the sentences of text, which is already trimmed.
+func (c *tokenChunker) chunk(text string) []string {
+	var spans []textSpan
+	for _, para := range splitAt(text, textSpan{0, len(text), 0}, paragraphBreak) {
+		for _, sentence := range splitAt(text, para, sentenceBreak) {
+			spans = append(spans, c.fit(text, sentence, lineBreak, wordBreak)...)
+		}
+	}
+
+	var chunks []string
+	for i := 0; i < len(spans); {
+		j, total := i, 0
+		for j < len(spans) && total+spans[j].tokens <= c.maxTokens {
+			total += spans[j].tokens
+			j++
+		}
+		if j == i {
+			// A span over budget, such as a single rune the tokenizer
+			// counts as several tokens, becomes a chunk of its own.
+			j++
+		}
+		chunks = append(chunks, text[spans[i].start:spans[j-1].end])
+		if j == len(spans) {
+			break
+		}
+		// Carry trailing sentences into the next chunk while they fit the
+		// overlap and leave room for the next new sentence.
+		k, carried := j, 0
+		for k-1 > i && carried+spans[k-1].tokens <= c.overlap && carried+spans[k-1].tokens+spans[j].tokens <= c.maxTokens {
+			k--
+			carried += spans[k].tokens
+		}
+		i = k
+	}
+	return chunks
+}
+
+// fit counts the tokens of s and, while it is over budget, splits it at the
+// given breaks in turn, finally between characters.
+func (c *tokenChunker) fit(text string, s textSpan, breaks ...*regexp.Regexp) []textSpan {
+	s.tokens = c.tok.Count(text[s.start:s.end])
+	if s.tokens <= c.maxTokens {
+		return []textSpan{s}
+	}
+	for i, re := range breaks {
+		parts := splitAt(text, s, re)
+		if len(parts) < 2 {
+			continue
+		}
+		var out []textSpan
+		for _, p := range parts {
+			out = append(out, c.fit(text, p, breaks[i+1:]...)...)
+		}
+		return out
+	}
+
+	// A single unbroken run, such as a long URL or encoded blob: cut it into
+	// the longest pieces that fit, on rune boundaries.
+	var bounds []int // rune boundaries after s.start
+	for i := range text[s.start:s.end] {
+		if i > 0 {
+			bounds = append(bounds, s.start+i)
+		}
+	}
+	bounds = append(bounds, s.end)
+
+	var out []textSpan
+	for start, first := s.start, 0; first < len(bounds); {
+		// The longest piece that fits, but always at least one rune.
+		n := sort.Search(len(bounds)-first, func(k int) bool {
+			return k > 0 && c.tok.Count(text[start:bounds[first+k]]) > c.maxTokens
+		})
+		end := bounds[first+n-1]
+		out = append(out, textSpan{start, end, c.tok.Count(text[start:end])})
+		first += n
+		start = end
+	}
+	return out
+}
+
+// splitAt splits span s of text around the matches of re, dropping the
+// separators (or, when re has a group, only the group's part of each match)
+// and any empty pieces.
+func splitAt(text string, s textSpan, re *regexp.Regexp) []textSpan {
+	var out []textSpan
+	start := s.start
+	for _, m := range re.FindAllStringSubmatchIndex(text[s.start:s.end], -1) {
+		sepStart, sepEnd := m[0], m[1]
+		if len(m) > 2 {
+			sepStart, sepEnd = m[2], m[3]
+		}
+		if end := s.start + sepStart; end > start {
+			out = append(out, textSpan{start: start, end: end})
+		}
+		start = s.start + sepEnd
+	}
+	if start < s.end {
+		out = append(out, textSpan{start: start, end: s.end})
+	}
+	return out
+}
+
+// ------------------
+// Paragraph chunker
+// ------------------
+
+// paragraphChunker is the original chunker: one chunk per paragraph, with
+// paragraphs longer than size bytes split between words. A heading is
+// prepended as is.
+type paragraphChunker struct {
+	size int
+}
+
+func (c paragraphChunker) Chunk(heading, text string) []string {
+	chunks := chunkText(text, c.size)
+	if heading = strings.TrimSpace(heading); heading != "" {
+		for i := range chunks {
+			chunks[i] = heading + "\n" + chunks[i]
+		}
+	}
+	return chunks
+}
+
+func (c paragraphChunker) Signature() string {
+	return fmt.Sprintf("%s:%d", chunkerParagraph, c.size)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// wordTokenizer counts whitespace-separated words, so expected chunk sizes
+// are easy to work out by hand.
+type wordTokenizer struct{}
+
+func (wordTokenizer) Name() string          { return "words" }
+func (wordTokenizer) Count(text string) int { return len(strings.Fields(text)) }
+
+func TestTokenChunker(t *testing.T) {
+	cases := []struct {
+		maxTokens, overlap int
+		heading, text      string
+		want               []string
+	}{
+		{
+			maxTokens: 6,
+			text:      "One two three. Four five six. Seven eight.",
+			want:      []string{"One two three. Four five six.", "Seven eight."},
+		},
+		{
+			// The last sentence is carried into the next chunk.
+			maxTokens: 6, overlap: 3,
+			text: "One two three. Four five six. Seven eight.",
+			want: []string{"One two three. Four five six.", "Four five six. Seven eight."},
+		},
+		{
+			// Overlap never carries a sentence that leaves no room for a new one.
+			maxTokens: 6, overlap: 6,
+			text: "One two three four. Five six. Seven eight nine.",
+			want: []string{"One two three four. Five six.", "Five six. Seven eight nine."},
+		},
+		{
+			// Chunks are verbatim slices, paragraph breaks included.
+			maxTokens: 6,
+			text:      "A b.\n\nC d.",
+			want:      []string{"A b.\n\nC d."},
+		},
+		{
+			// A sentence over budget is split between words.
+			maxTokens: 2,
+			text:      "a b c d e",
+			want:      []string{"a b", "c d", "e"},
+		},
+		{
+			maxTokens: 2, overlap: 1,
+			text: "a b c d e",
+			want: []string{"a b", "b c", "c d", "d e"},
+		},
+		{
+			// The heading counts toward the budget; a long path loses its
+			// outer levels.
+			maxTokens: 8,
+			heading:   "Doc > Part",
+			text:      "a b c d e f g h",
+			want:      []string{"Part\na b c d e f g", "Part\nh"},
+		},
+		{maxTokens: 6, text: "  \n "},
+	}
+	for _, tc := range cases {
+		c := &tokenChunker{tok: wordTokenizer{}, maxTokens: tc.maxTokens, overlap: tc.overlap}
+		got := c.Chunk(tc.heading, tc.text)
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tc.want) {
+			t.Fatalf("max %d overlap %d: Chunk(%q, %q) = %q, want %q", tc.maxTokens, tc.overlap, tc.heading, tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestTokenChunkerFitRuneBoundaries(t *testing.T) {
+	// estimateTokenizer counts a word as one token per six runes, so an
+	// unbroken run of 20 two-byte runes is 4 tokens and has to be cut between
+	// characters.
+	c := &tokenChunker{tok: estimateTokenizer{}, maxTokens: 2}
+	text := strings.Repeat("é", 20)
+	spans := c.fit(text, textSpan{0, len(text), 0}, lineBreak, wordBreak)
+
+	var pieces []int
+	end := 0
+	for _, s := range spans {
+		piece := text[s.start:s.end]
+		if s.start != end || !utf8.ValidString(piece) {
+			t.Fatalf("span %+v does not continue at %d on a rune boundary", s, end)
+		}
+		if s.tokens > c.maxTokens || s.tokens != c.tok.Count(piece) {
+			t.Fatalf("span %+v: %d tokens, budget %d", s, c.tok.Count(piece), c.maxTokens)
+		}
+		pieces = append(pieces, utf8.RuneCountInString(piece))
+		end = s.end
+	}
+	if end != len(text) || fmt.Sprint(pieces) != "[12 8]" {
+		t.Fatalf("pieces = %v runes ending at %d, want [12 8] ending at %d", pieces, end, len(text))
+	}
+
+	// A single rune over budget still makes progress.
+	c.maxTokens = 0
+	if spans := c.fit("ab", textSpan{0, 2, 0}); len(spans) != 2 {
+		t.Fatalf("fit with no budget = %+v, want one span per rune", spans)
+	}
+}
+
+// runeTokenizer counts every rune as two tokens, so no single rune fits a
+// budget of one.
+type runeTokenizer struct{}
+
+func (runeTokenizer) Name() string          { return "runes" }
+func (runeTokenizer) Count(text string) int { return 2 * utf8.RuneCountInString(text) }
+
+func TestTokenChunkerSpanOverBudget(t *testing.T) {
+	c := &tokenChunker{tok: runeTokenizer{}, maxTokens: 1}
+	if got := c.Chunk("", "abc"); fmt.Sprintf("%q", got) != `["a" "b" "c"]` {
+		t.Fatalf("chunks = %q, want one per rune", got)
+	}
+}
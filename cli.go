@@ -0,0 +1,683 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// cliOptions holds the flags every command accepts. Flags given before the
+// command name set the same values, so "--session x ask ..." and
+// "ask --session x ..." are equivalent.
+type cliOptions struct {
+	json        bool
+	session     string
+	user        string
+	allSessions bool
+	agent       string
+	backend     string
+	stream      bool
+	verbose     bool
+
+	set map[string]bool // flags given explicitly, by name
+}
+
+func (o *cliOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.json, "json", o.json, "print JSON instead of text")
+	fs.StringVar(&o.session, "session", o.session, "conversation session to store turns under and retrieve memory from")
+	fs.StringVar(&o.user, "user", o.user, "user ID recorded with each stored turn")
+	fs.BoolVar(&o.allSessions, "all-sessions", o.allSessions, "retrieve memory and history across every session of --user")
+	fs.StringVar(&o.agent, "agent", o.agent, "agent type: react (text-parsed tool use) or tools (native function calling)")
+	fs.StringVar(&o.backend, "backend", o.backend, "LLM backend: openrouter or gemini (gemini requires --agent=tools)")
+	fs.BoolVar(&o.stream, "stream", o.stream, "stream the final answer token by token")
+	fs.BoolVar(&o.verbose, "verbose", o.verbose, "show the agent's intermediate steps (Thought/Action text or tool calls) dimmed")
+}
+
+func (o *cliOptions) sessionFor() Session {
+	return Session{ID: o.session, UserID: o.user, CrossSession: o.allSessions}
+}
+
+// cmdRunner runs a command once its flags are parsed and the runtime it
+// needs is up.
+type cmdRunner func(ctx context.Context, opts *cliOptions, args []string) error
+
+type command struct {
+	name    string
+	args    string // positional arguments, for usage
+	summary string
+	minArgs int
+	maxArgs int // -1 for no limit
+	needs   runtimeNeeds
+	noJSON  bool
+	// setup registers the command's own flags and returns its runner.
+	setup func(fs *flag.FlagSet) cmdRunner
+}
+
+func cliCommands() []*command {
+	return []*command{
+		{
+			name: "ask", args: `"<prompt>"`, summary: "answer one prompt with the agent",
+			minArgs: 1, maxArgs: -1, needs: needAgent,
+			setup: func(fs *flag.FlagSet) cmdRunner { return runAsk },
+		},
+		{
+			name: "chat", summary: "answer prompts from stdin until EOF or /quit",
+			maxArgs: 0, needs: needAgent, noJSON: true,
+			setup: func(fs *flag.FlagSet) cmdRunner { return runChatCommand },
+		},
+		{
+			name: "serve", summary: "serve the HTTP API",
+			maxArgs: 0, needs: needAgent, noJSON: true,
+			setup: func(fs *flag.FlagSet) cmdRunner {
+				addr := fs.String("addr", currentConfig.ServeAddr, "address to listen on")
+				return func(ctx context.Context, opts *cliOptions, args []string) error {
+					return runServer(ctx, *addr)
+				}
+			},
+		},
+		{
+			name: "batch", args: "<prompts.jsonl>", summary: "run prompts from a JSONL file and write JSONL results",
+			minArgs: 1, maxArgs: 1, needs: needAgent,
+			setup: func(fs *flag.FlagSet) cmdRunner {
+				out := fs.String("out", "", "results file (default: <input>.results.jsonl)")
+				concurrency := fs.Int("concurrency", currentConfig.BatchConcurrency, "number of prompts run at once")
+				return func(ctx context.Context, opts *cliOptions, args []string) error {
+					return runBatchCommand(ctx, opts, args[0], *out, *concurrency)
+				}
+			},
+		},
+		{
+			name: "ingest", args: "[paths...]", summary: "index files or directories (default: RAG_DATA_DIR) without asking anything",
+			maxArgs: -1, needs: needEmbedder,
+			setup: func(fs *flag.FlagSet) cmdRunner {
+				dryRun := fs.Bool("dry-run", currentConfig.ReconcileDryRun, "only report stale chunks instead of deleting them")
+				return func(ctx context.Context, opts *cliOptions, args []string) error {
+					return runIngest(ctx, opts, args, *dryRun)
+				}
+			},
+		},
+		{
+			name: "search", args: `"<query>"`, summary: "show what retrieval returns for a query, without calling the LLM",
+			minArgs: 1, maxArgs: -1, needs: needEmbedder,
+			setup: func(fs *flag.FlagSet) cmdRunner {
+				mode := fs.String("mode", retrieveHybrid, "retrieval mode: bm25, vector or hybrid")
+				k := fs.Int("k", 5, "number of results")
+				collection := fs.String("collection", "docs", "collection to search: docs or memory")
+				return func(ctx context.Context, opts *cliOptions, args []string) error {
+					return runSearch(ctx, opts, strings.Join(args, " "), *mode, *k, *collection)
+				}
+			},
+		},
+		{
+			name: "explain", args: `"<query>"`, summary: "show how BM25 and vector search ranked each hybrid retrieval candidate",
+			minArgs: 1, maxArgs: -1, needs: needEmbedder,
+			setup: func(fs *flag.FlagSet) cmdRunner {
+				k := fs.Int("k", 5, "number of results each retriever returns and hybrid retrieval keeps")
+				collection := fs.String("collection", "docs", "collection to search: docs or memory")
+				return func(ctx context.Context, opts *cliOptions, args []string) error {
+					return runExplain(ctx, opts, strings.Join(args, " "), *k, *collection)
+				}
+			},
+		},
+		{
+			name: "history", summary: "print stored conversation turns of the session",
+			maxArgs: 0, needs: needChroma,
+			setup: func(fs *flag.FlagSet) cmdRunner {
+				last := fs.Int("last", currentConfig.HistoryLast, "number of most recent turns to print, 0 for all")
+				since := fs.String("since", currentConfig.HistorySince, "only turns after this RFC3339 time or duration ago (e.g. 72h or 7d)")
+				return func(ctx context.Context, opts *cliOptions, args []string) error {
+					return runHistory(ctx, opts, *last, *since)
+				}
+			},
+		},
+		{
+			name: "forget", args: "<turn-id...> | --session <id>", summary: "delete stored turns by ID, or every turn of a session",
+			maxArgs: -1, needs: needIndexes,
+			setup: func(fs *flag.FlagSet) cmdRunner { return runForget },
+		},
+		{
+			name: "sessions", summary: "list sessions with turn counts and last activity",
+			maxArgs: 0, needs: needChroma,
+			setup: func(fs *flag.FlagSet) cmdRunner { return runSessions },
+		},
+		{
+			name: "stats", summary: "show what the stores and indexes hold",
+			maxArgs: 0, needs: needIndexes,
+			setup: func(fs *flag.FlagSet) cmdRunner { return runStats },
+		},
+	}
+}
+
+// runCLI parses args, sets up what the command needs and runs it, returning
+// the process exit code. A first argument that is not a command name is a
+// prompt for ask, so `toolrag "prompt"` keeps working.
+func runCLI(args []string) int {
+	opts := &cliOptions{
+		session: currentConfig.SessionID,
+		user:    currentConfig.UserID,
+		agent:   currentConfig.AgentMode,
+		backend: currentConfig.LLMBackend,
+		stream:  currentConfig.Stream,
+		set:     map[string]bool{},
+	}
+	commands := cliCommands()
+
+	top := flag.NewFlagSet("toolrag", flag.ContinueOnError)
+	opts.register(top)
+	listSessionsFlag := top.Bool("list-sessions", false, "same as the sessions command")
+	top.Usage = func() { printCLIUsage(top, commands) }
+	if err := top.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	top.Visit(func(f *flag.Flag) { opts.set[f.Name] = true })
+
+	rest := top.Args()
+	var cmd *command
+	switch {
+	case *listSessionsFlag:
+		cmd = findCommand(commands, "sessions")
+	case len(rest) == 0:
+		top.Usage()
+		return 2
+	default:
+		if cmd = findCommand(commands, rest[0]); cmd != nil {
+			rest = rest[1:]
+		} else {
+			cmd = findCommand(commands, "ask")
+		}
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	opts.register(fs)
+	run := cmd.setup(fs)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: go run . %s [flags]\n\n%s.\n\nFlags:\n", strings.TrimSpace(cmd.name+" "+cmd.args), capitalize(cmd.summary))
+		fs.PrintDefaults()
+	}
+	args, err := parseInterspersed(fs, rest)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	fs.Visit(func(f *flag.Flag) { opts.set[f.Name] = true })
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		fs.Usage()
+		return 2
+	}
+	if opts.json && cmd.noJSON {
+		fmt.Fprintf(os.Stderr, "%s does not support --json\n", cmd.name)
+		return 2
+	}
+
+	currentConfig.AgentMode = opts.agent
+	currentConfig.LLMBackend = opts.backend
+	if err := checkRuntimeConfig(currentConfig, cmd.needs); err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	closeRuntime, err := initRuntime(ctx, cmd.needs)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer closeRuntime()
+
+	if err := run(ctx, opts, args); err != nil {
+		log.Printf("%s: %v", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+func findCommand(commands []*command, name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func printCLIUsage(top *flag.FlagSet, commands []*command) {
+	out := top.Output()
+	fmt.Fprintln(out, "Usage: go run . [flags] <command> [arguments] [flags]")
+	fmt.Fprintln(out, "       go run . [flags] \"<prompt>\"   (same as ask)")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(out, "\nRun go run . <command> -h for a command's flags. Flags accepted by every command:")
+	top.PrintDefaults()
+}
+
+// parseInterspersed parses fs from args, allowing flags after positional
+// arguments (search "query" --mode=bm25). A "--" ends flag parsing.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := args[:len(args)-len(rest)]; endsFlags(fs, consumed) {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// endsFlags reports whether the flag arguments fs just consumed end in a
+// "--" terminator rather than a flag given "--" as its value (--out --).
+// It replays the flag package's parse: a non-boolean flag without "=" takes
+// the next argument as its value.
+func endsFlags(fs *flag.FlagSet, consumed []string) bool {
+	for i := 0; i < len(consumed); i++ {
+		a := consumed[i]
+		if a == "--" {
+			return i == len(consumed)-1
+		}
+		name := strings.TrimLeft(a, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			i++
+		}
+	}
+	return false
+}
+
+func flagExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ------------------
+// Commands
+// ------------------
+
+// askResult is the --json output of ask.
+type askResult struct {
+	Session   string   `json:"session"`
+	Prompt    string   `json:"prompt"`
+	Response  string   `json:"response"`
+	Tools     []string `json:"tools"`
+	Sources   []string `json:"sources"`
+	LatencyMS int64    `json:"latency_ms"`
+}
+
+func runAsk(ctx context.Context, opts *cliOptions, args []string) error {
+	session := opts.sessionFor()
+	prompt := strings.Join(args, " ")
+
+	if opts.json {
+		seedConversationLog(ctx, session, nil)
+		start := time.Now()
+		response, trace, err := askAgent(ctx, session, prompt, streamOptions{})
+		if err != nil {
+			return fmt.Errorf("agent execution failed: %w", err)
+		}
+		return printJSON(askResult{
+			Session:   session.ID,
+			Prompt:    prompt,
+			Response:  response,
+			Tools:     trace.Tools(),
+			Sources:   trace.SourceIDs(),
+			LatencyMS: time.Since(start).Milliseconds(),
+		})
+	}
+
+	seedConversationLog(ctx, session, os.Stdout)
+
+	// When streaming, the answer is shown live under the final response
+	// header instead of being printed after the run.
+	if opts.stream {
+		fmt.Println("\n=== Final Response ===")
+		if _, _, err := askAgent(ctx, session, prompt, streamOptions{Out: os.Stdout, Verbose: opts.verbose}); err != nil {
+			return fmt.Errorf("agent execution failed: %w", err)
+		}
+		return nil
+	}
+
+	response, _, err := askAgent(ctx, session, prompt, streamOptions{})
+	if err != nil {
+		return fmt.Errorf("agent execution failed: %w", err)
+	}
+
+	// The printed conversation log is conversation-only, not tool traces.
+	for _, m := range conversationLog {
+		fmt.Println(formatChatMessage(m))
+	}
+
+	fmt.Println("\n=== Final Response ===")
+	fmt.Println(response)
+	return nil
+}
+
+func runChatCommand(ctx context.Context, opts *cliOptions, args []string) error {
+	session := opts.sessionFor()
+	seedConversationLog(ctx, session, os.Stdout)
+	if err := runChat(ctx, session, os.Stdin, os.Stdout, opts.stream, opts.verbose); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("chat ended: %w", err)
+	}
+	return nil
+}
+
+// seedConversationLog loads the session's prior turns (HISTORY_LAST,
+// HISTORY_SINCE) into conversationLog, which the agent sees as context, and
+// prints them to out unless it is nil.
+func seedConversationLog(ctx context.Context, session Session, out io.Writer) {
+	if out != nil {
+		fmt.Fprintln(out, "=== Conversation History ===")
+	}
+	historyOpts := HistoryOptions{Last: currentConfig.HistoryLast, Session: session}
+	var err error
+	if historyOpts.Since, err = parseSince(currentConfig.HistorySince, time.Now()); err != nil {
+		log.Printf("Warning: ignoring HISTORY_SINCE: %v", err)
+	}
+	prior, err := listConversationHistory(ctx, historyOpts)
+	if err != nil {
+		log.Printf("Warning: Failed to load conversation history: %v", err)
+	}
+	for _, turn := range prior {
+		if out != nil {
+			fmt.Fprintln(out, turn.Text)
+		}
+		conversationLog = append(conversationLog, turnMessages(turn.Text)...)
+	}
+}
+
+func runBatchCommand(ctx context.Context, opts *cliOptions, input, output string, concurrency int) error {
+	if output == "" {
+		output = strings.TrimSuffix(input, filepath.Ext(input)) + ".results.jsonl"
+	}
+	// Lines without a session share one only when --session asks for it.
+	session := opts.sessionFor()
+	if !opts.set["session"] {
+		session.ID = ""
+	}
+	summary, err := runBatch(ctx, batchOptions{
+		InputPath:   input,
+		OutputPath:  output,
+		Concurrency: concurrency,
+		Session:     session,
+	})
+	if opts.json && summary != nil {
+		if jerr := printJSON(summary); jerr != nil && err == nil {
+			err = jerr
+		}
+	}
+	return err
+}
+
+func runIngest(ctx context.Context, opts *cliOptions, paths []string, dryRun bool) error {
+	if len(paths) == 0 {
+		dataDir := currentConfig.RAGDataDir
+		if dataDir == "" {
+			dataDir = "./data"
+		}
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			return fmt.Errorf("failed to create data directory: %w", err)
+		}
+		paths = []string{dataDir}
+	}
+
+	summary, err := ingestPaths(ctx, paths, dryRun)
+	if summary.Changed() {
+		saveBM25Index(lexicalIndex(ragDocsCollection), ragDocsCollection)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		return printJSON(summary)
+	}
+	fmt.Printf("Ingested %s: %d chunks from %d changed files, %d unchanged files, %d left out\n",
+		strings.Join(summary.Paths, ", "), summary.ChunksIndexed, summary.ChangedFiles, summary.UnchangedFiles, len(summary.Skipped))
+
+	if summary.DryRun && summary.StaleChunks > 0 {
+		fmt.Printf("%d stale chunks would be removed\n", summary.StaleChunks)
+	} else if summary.RemovedChunks > 0 {
+		fmt.Printf("Removed %d stale chunks\n", summary.RemovedChunks)
+	}
+	return nil
+}
+
+// searchTarget resolves the --collection flag to a collection and, for
+// memory, the session filter.
+func searchTarget(opts *cliOptions, collection string) (chroma.Collection, metaFilter, error) {
+	switch collection {
+	case "docs":
+		return ragDocsCollection, nil, nil
+	case "memory":
+		return conversationCollection, opts.sessionFor().memoryFilter(), nil
+	default:
+		return nil, nil, fmt.Errorf(`unknown collection %q (want "docs" or "memory")`, collection)
+	}
+}
+
+func runSearch(ctx context.Context, opts *cliOptions, query, mode string, k int, collection string) error {
+	c, filter, err := searchTarget(opts, collection)
+	if err != nil {
+		return err
+	}
+
+	rs, err := retrieveWithMode(ctx, mode, c, query, k, filter)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		results := make([]retrieveResult, 0, len(rs))
+		for _, r := range rs {
+			results = append(results, retrieveResult{ID: r.ID, Collection: collection, Source: r.Source, Text: r.Text, Meta: r.Meta, Score: r.Score})
+		}
+		return printJSON(results)
+	}
+	if len(rs) == 0 {
+		fmt.Println("No results.")
+		return nil
+	}
+	for i, r := range rs {
+		label := r.Source
+		if label == "" {
+			label = "conversation memory"
+		}
+		fmt.Printf("%d. %s [%s]\n", i+1, label, r.ID)
+		fmt.Printf("   %s\n\n", strings.Join(strings.Fields(r.Text), " "))
+	}
+	return nil
+}
+
+// explainRow is one line of explain's --json output.
+type explainRow struct {
+	retrieveResult
+	Returned bool `json:"returned"`
+}
+
+// runExplain prints every hybrid retrieval candidate with its BM25 and
+// vector rank and score, fused RRF score and matched terms. Rows marked *
+// are the ones hybrid retrieval returns.
+func runExplain(ctx context.Context, opts *cliOptions, query string, k int, collection string) error {
+	c, filter, err := searchTarget(opts, collection)
+	if err != nil {
+		return err
+	}
+	rs, err := hybridCandidates(ctx, c, query, k, filter)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		rows := make([]explainRow, 0, len(rs))
+		for i, r := range rs {
+			rows = append(rows, explainRow{
+				retrieveResult: retrieveResult{ID: r.ID, Collection: collection, Source: r.Source, Text: r.Text, Meta: r.Meta, Score: r.Score},
+				Returned:       i < k,
+			})
+		}
+		return printJSON(rows)
+	}
+	if len(rs) == 0 {
+		fmt.Println("No results.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tRRF\tBM25 #\tBM25\tVEC #\tDISTANCE\tMATCHED TERMS\tSOURCE")
+	for i, r := range rs {
+		rank := fmt.Sprintf("%d", i+1)
+		if i < k {
+			rank = "*" + rank
+		}
+		bm25Rank, bm25Score, terms := "-", "-", "-"
+		if r.Score.BM25Rank > 0 {
+			bm25Rank = fmt.Sprintf("%d", r.Score.BM25Rank)
+			bm25Score = fmt.Sprintf("%.3f", r.Score.BM25Score)
+			terms = strings.Join(r.Score.MatchedTerms, ",")
+		}
+		vecRank, dist := "-", "-"
+		if r.Score.VectorRank > 0 {
+			vecRank = fmt.Sprintf("%d", r.Score.VectorRank)
+			dist = fmt.Sprintf("%.4f", r.Score.VectorDistance)
+		}
+		label := r.Source
+		if label == "" {
+			label = "conversation memory"
+		}
+		fmt.Fprintf(w, "%s\t%.4f\t%s\t%s\t%s\t%s\t%s\t%s [%s]\n", rank, r.Score.FusedScore, bm25Rank, bm25Score, vecRank, dist, terms, label, shortID(r.ID))
+	}
+	return w.Flush()
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func runHistory(ctx context.Context, opts *cliOptions, last int, since string) error {
+	historyOpts := HistoryOptions{Last: last, Session: opts.sessionFor()}
+	var err error
+	if historyOpts.Since, err = parseSince(since, time.Now()); err != nil {
+		return err
+	}
+	turns, err := listConversationHistory(ctx, historyOpts)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		return printJSON(turns)
+	}
+	for _, t := range turns {
+		ts := "-"
+		if !t.Timestamp.IsZero() {
+			ts = t.Timestamp.Local().Format(time.RFC3339)
+		}
+		fmt.Printf("--- %s  session=%s  id=%s\n%s\n\n", ts, t.Session, t.ID, t.Text)
+	}
+	return nil
+}
+
+// forgetResult is the --json output of forget.
+type forgetResult struct {
+	Removed []string `json:"removed"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+func runForget(ctx context.Context, opts *cliOptions, ids []string) error {
+	var res forgetResult
+	var err error
+	switch {
+	case len(ids) > 0 && opts.set["session"]:
+		return errors.New("give turn IDs or --session, not both")
+	case len(ids) > 0:
+		res.Removed, res.Missing, err = forgetTurns(ctx, ids)
+	case opts.set["session"]:
+		res.Removed, err = forgetSession(ctx, opts.sessionFor())
+	default:
+		return errors.New("give the turn IDs to forget (see the history command) or --session")
+	}
+	if err != nil {
+		return err
+	}
+	if res.Removed == nil {
+		res.Removed = []string{}
+	}
+
+	if opts.json {
+		return printJSON(res)
+	}
+	fmt.Printf("Forgot %d turn(s)\n", len(res.Removed))
+	if len(res.Missing) > 0 {
+		fmt.Printf("Not found: %s\n", strings.Join(res.Missing, ", "))
+	}
+	return nil
+}
+
+func runSessions(ctx context.Context, opts *cliOptions, args []string) error {
+	sessions, err := listSessions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+	if opts.json {
+		return printJSON(sessions)
+	}
+	printSessions(sessions)
+	return nil
+}
+
+func runStats(ctx context.Context, opts *cliOptions, args []string) error {
+	stats, err := collectStats(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(stats)
+	}
+	printStats(os.Stdout, stats)
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	cases := []struct {
+		args []string
+		want []string // positional arguments
+		mode string
+		k    int
+		json bool
+		err  bool
+	}{
+		{args: nil, want: nil, mode: "hybrid", k: 5},
+		{args: []string{"query"}, want: []string{"query"}, mode: "hybrid", k: 5},
+		{args: []string{"--mode=bm25", "query"}, want: []string{"query"}, mode: "bm25", k: 5},
+		{args: []string{"query", "--mode", "bm25", "more"}, want: []string{"query", "more"}, mode: "bm25", k: 5},
+		{args: []string{"a", "-k", "3", "b", "--json", "c"}, want: []string{"a", "b", "c"}, mode: "hybrid", k: 3, json: true},
+		{args: []string{"a", "-"}, want: []string{"a", "-"}, mode: "hybrid", k: 5},
+		// "--" ends flag parsing, wherever it appears.
+		{args: []string{"--", "--mode=bm25"}, want: []string{"--mode=bm25"}, mode: "hybrid", k: 5},
+		{args: []string{"a", "--json", "--", "-k", "3"}, want: []string{"a", "-k", "3"}, mode: "hybrid", k: 5, json: true},
+		{args: []string{"a", "--", "b", "--"}, want: []string{"a", "b", "--"}, mode: "hybrid", k: 5},
+		// A flag may take "--" as its value.
+		{args: []string{"a", "--mode", "--", "-k", "2"}, want: []string{"a"}, mode: "--", k: 2},
+		{args: []string{"--mode", "--json", "--", "-k"}, want: []string{"-k"}, mode: "--json", k: 5},
+		{args: []string{"a", "--nope"}, err: true},
+		{args: []string{"a", "-k"}, err: true},
+		{args: []string{"a", "-k", "x"}, err: true},
+	}
+	for _, tc := range cases {
+		fs := flag.NewFlagSet("search", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		mode := fs.String("mode", "hybrid", "")
+		k := fs.Int("k", 5, "")
+		asJSON := fs.Bool("json", false, "")
+
+		got, err := parseInterspersed(fs, tc.args)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("%q: expected error, got %q", tc.args, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", tc.args, err)
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tc.want) || *mode != tc.mode || *k != tc.k || *asJSON != tc.json {
+			t.Fatalf("%q: positional %q, mode %q, k %d, json %v; want %q, %q, %d, %v",
+				tc.args, got, *mode, *k, *asJSON, tc.want, tc.mode, tc.k, tc.json)
+		}
+	}
+}
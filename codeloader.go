@@ -0,0 +1,223 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// codeLoader splits source code at top-level declarations, so chunks follow
+// declaration boundaries instead of cutting functions and types at an
+// arbitrary point. Each section records the "symbol" names it declares and
+// the "line" it starts at. Go is split with go/parser; other languages, and
+// Go that does not parse, by indentation: a declaration starts at a line
+// with no indentation and runs until the next one.
+type codeLoader struct {
+	lang string
+}
+
+// maxSymbols is how many declared names a chunk's "symbol" lists.
+const maxSymbols = 5
+
+// codeBlock is one top-level declaration: its byte range and the names it
+// declares.
+type codeBlock struct {
+	start, end int
+	names      []string
+}
+
+func (l codeLoader) Load(path string, data []byte) (*Document, error) {
+	text := strings.ToValidUTF8(strings.ReplaceAll(string(data), "\r\n", "\n"), "�")
+
+	var blocks []codeBlock
+	if l.lang == "go" {
+		blocks = goBlocks(path, text)
+	}
+	if blocks == nil {
+		blocks = indentBlocks(l.lang, text)
+	}
+
+	// Every declaration is a section that chunkDocument may merge with its
+	// neighbours, so runs of one-line declarations (constants, imports, YAML
+	// keys) do not each become a chunk of their own.
+	doc := &Document{Format: l.lang}
+	for _, b := range blocks {
+		for b.start < b.end && text[b.start] == '\n' {
+			b.start++
+		}
+		body := strings.TrimRight(text[b.start:b.end], "\n")
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+		doc.Sections = append(doc.Sections, DocumentSection{
+			Text:    body,
+			Meta:    map[string]interface{}{"line": strings.Count(text[:b.start], "\n") + 1},
+			Symbols: b.names,
+			Merge:   true,
+		})
+	}
+	return doc, nil
+}
+
+// symbolList formats names as a chunk's "symbol": the first maxSymbols,
+// then "..." if there are more.
+func symbolList(names []string) string {
+	if len(names) > maxSymbols {
+		names = append(names[:maxSymbols:maxSymbols], "...")
+	}
+	return strings.Join(names, ", ")
+}
+
+// goBlocks splits Go source at its top-level declarations, each with its doc
+// comment and any comments before it. The package clause and file comments
+// go with the first declaration. It returns nil if the file does not parse.
+func goBlocks(path, text string) []codeBlock {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, text, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil || len(f.Decls) == 0 {
+		return nil
+	}
+
+	var blocks []codeBlock
+	start := 0
+	for _, d := range f.Decls {
+		end := fset.Position(d.End()).Offset
+		if i := strings.IndexByte(text[end:], '\n'); i >= 0 {
+			end += i + 1
+		} else {
+			end = len(text)
+		}
+		blocks = append(blocks, codeBlock{start: start, end: end, names: goDeclNames(d)})
+		start = end
+	}
+	if start < len(text) {
+		// Trailing comments belong to the last declaration.
+		blocks[len(blocks)-1].end = len(text)
+	}
+	return blocks
+}
+
+// goDeclNames returns the names a declaration declares; methods are named
+// after their receiver type, as in "Server.Handle". Imports declare none.
+func goDeclNames(d ast.Decl) []string {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			if recv := goTypeName(d.Recv.List[0].Type); recv != "" {
+				return []string{recv + "." + d.Name.Name}
+			}
+		}
+		return []string{d.Name.Name}
+	case *ast.GenDecl:
+		var names []string
+		for _, s := range d.Specs {
+			switch s := s.(type) {
+			case *ast.TypeSpec:
+				names = append(names, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, n := range s.Names {
+					if n.Name != "_" {
+						names = append(names, n.Name)
+					}
+				}
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// goTypeName is the name of a receiver type, without pointer or type
+// parameters.
+func goTypeName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.StarExpr:
+		return goTypeName(e.X)
+	case *ast.IndexExpr:
+		return goTypeName(e.X)
+	case *ast.IndexListExpr:
+		return goTypeName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+var (
+	// codeDeclName finds the declared name on the first line of a
+	// declaration in most C-like and scripting languages.
+	codeDeclName = regexp.MustCompile(`(?i)\b(?:func|function|def|class|struct|interface|enum|trait|impl|type|module|fn|sub|procedure|message|service|resource|table|view|const|let|var|val)\s+"?([A-Za-z_$][\w$.:-]*)`)
+	// codeKeyName finds a key being assigned, as in YAML, TOML, INI or
+	// shell: "key:", "key =", "[section]".
+	codeKeyName = regexp.MustCompile(`^(?:export\s+)?["']?([A-Za-z_][\w.-]*)["']?\s*(?::(?:\s|$)|=)|^\[+\s*([^\]]+?)\s*\]+`)
+	// codeLeading matches lines that belong to the declaration after them:
+	// comments, decorators and attributes.
+	codeLeading = regexp.MustCompile(`^(?:#|//|/\*|\*|--|;|@|%)`)
+	// codeContinued matches unindented lines that continue the declaration
+	// before them rather than start a new one: closing brackets and keywords,
+	// or an opening brace on a line of its own.
+	codeContinued = regexp.MustCompile(`^(?:[{}\])]|end\b|fi\b|done\b|esac\b|EOF\b|\.\.\.$)`)
+)
+
+// indentBlocks splits source at unindented lines, keeping braces and closing
+// keywords with the block they belong to and comments with the declaration
+// that follows them.
+func indentBlocks(lang, text string) []codeBlock {
+	var (
+		blocks  []codeBlock
+		cur     = codeBlock{start: 0}
+		started bool // cur has a line of code
+		lead    = -1 // where the comments before the next declaration start
+	)
+	for off := 0; off < len(text); {
+		next := len(text)
+		if i := strings.IndexByte(text[off:], '\n'); i >= 0 {
+			next = off + i + 1
+		}
+		line := strings.TrimRight(text[off:next], "\r\n")
+		indented := line == "" || line[0] == ' ' || line[0] == '\t'
+
+		switch {
+		case indented || codeContinued.MatchString(line):
+			lead = -1
+		case lang == "yaml" && strings.HasPrefix(line, "- ") && started:
+			// A sequence under a top-level key may start in column 0.
+			lead = -1
+		case codeLeading.MatchString(line) && !(lang == "yaml" && line == "---"):
+			if lead < 0 {
+				lead = off
+			}
+		default:
+			if started {
+				split := off
+				if lead >= 0 {
+					split = lead
+				}
+				cur.end = split
+				blocks = append(blocks, cur)
+				cur = codeBlock{start: split}
+			}
+			started = true
+			lead = -1
+			if name := codeSymbol(line); name != "" {
+				cur.names = append(cur.names, name)
+			}
+		}
+		off = next
+	}
+	cur.end = len(text)
+	return append(blocks, cur)
+}
+
+// codeSymbol guesses the name a declaration line declares.
+func codeSymbol(line string) string {
+	if m := codeDeclName.FindStringSubmatch(line); m != nil {
+		return strings.TrimRight(m[1], ":.")
+	}
+	if m := codeKeyName.FindStringSubmatch(line); m != nil {
+		return m[1] + m[2]
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// codeBlockText renders blocks as their text and names, for comparison.
+func codeBlockText(text string, blocks []codeBlock) []string {
+	var out []string
+	for _, b := range blocks {
+		out = append(out, fmt.Sprintf("%s%v", text[b.start:b.end], b.names))
+	}
+	return out
+}
+
+func TestGoBlocks(t *testing.T) {
+	src := strings.Join([]string{
+		"// Package demo is a demo.",
+		"package demo",
+		"",
+		`import "fmt"`,
+		"",
+		"// Greeting is said.",
+		`const Greeting = "hi"`,
+		"",
+		"type Server struct{}",
+		"",
+		"func (s *Server) Handle() {",
+		"\tfmt.Println(Greeting)",
+		"}",
+		"",
+		"func (l *List[T]) Len() int { return 0 }",
+		"",
+		"var a, _, b = 1, 2, 3",
+		"// trailing",
+		"",
+	}, "\n")
+	want := []string{
+		"// Package demo is a demo.\npackage demo\n\nimport \"fmt\"\n[]",
+		"\n// Greeting is said.\nconst Greeting = \"hi\"\n[Greeting]",
+		"\ntype Server struct{}\n[Server]",
+		"\nfunc (s *Server) Handle() {\n\tfmt.Println(Greeting)\n}\n[Server.Handle]",
+		"\nfunc (l *List[T]) Len() int { return 0 }\n[List.Len]",
+		"\nvar a, _, b = 1, 2, 3\n// trailing\n[a b]",
+	}
+	got := codeBlockText(src, goBlocks("demo.go", src))
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		t.Fatalf("goBlocks =\n%q\nwant\n%q", got, want)
+	}
+
+	for _, bad := range []string{"package demo\n\nfunc broken( {\n", "package demo\n"} {
+		if blocks := goBlocks("bad.go", bad); blocks != nil {
+			t.Fatalf("goBlocks(%q) = %v, want nil", bad, blocks)
+		}
+	}
+}
+
+func TestIndentBlocks(t *testing.T) {
+	cases := []struct {
+		lang, src string
+		want      []string
+	}{
+		{
+			lang: "yaml",
+			src: strings.Join([]string{
+				"# Service settings",
+				"name: api",
+				"replicas: 2",
+				"env:",
+				"  - A",
+				"  - B",
+				"ports:",
+				"- 80",
+				"- 443",
+				"---",
+				"# Database",
+				"db:",
+				"  host: x",
+				"",
+			}, "\n"),
+			want: []string{
+				"# Service settings\nname: api\n[name]",
+				"replicas: 2\n[replicas]",
+				"env:\n  - A\n  - B\n[env]",
+				"ports:\n- 80\n- 443\n[ports]",
+				"---\n[]",
+				"# Database\ndb:\n  host: x\n[db]",
+			},
+		},
+		{
+			lang: "python",
+			src: strings.Join([]string{
+				"import os",
+				"",
+				"@cached",
+				"def load(path):",
+				"    return os.stat(path)",
+				"",
+				"class Store:",
+				"    pass",
+			}, "\n"),
+			want: []string{
+				"import os\n\n[]",
+				"@cached\ndef load(path):\n    return os.stat(path)\n\n[load]",
+				"class Store:\n    pass[Store]",
+			},
+		},
+		{
+			// Closing braces stay with the block they close.
+			lang: "javascript",
+			src:  "function a() {\n  return 1;\n}\nconst b = 2;\n",
+			want: []string{"function a() {\n  return 1;\n}\n[a]", "const b = 2;\n[b]"},
+		},
+	}
+	for _, tc := range cases {
+		got := codeBlockText(tc.src, indentBlocks(tc.lang, tc.src))
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tc.want) {
+			t.Fatalf("indentBlocks(%s) =\n%q\nwant\n%q", tc.lang, got, tc.want)
+		}
+	}
+}
+
+func TestCodeChunksMergeWithinBudget(t *testing.T) {
+	src := strings.Join([]string{
+		"package demo",
+		"",
+		"const A = 1",
+		"const B = 2",
+		"const C = 3",
+		"",
+		"func Long() { println(1, 2, 3, 4, 5, 6) }",
+		"",
+		"var D = 4",
+	}, "\n")
+	doc, err := codeLoader{lang: "go"}.Load("demo.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Words as tokens: the package clause is 2, each const 4, Long 10.
+	chunker := &tokenChunker{tok: wordTokenizer{}, maxTokens: 10}
+	var got []string
+	for _, c := range chunkDocument(doc, chunker) {
+		got = append(got, fmt.Sprintf("%v@%v %v-%v: %s", c.Meta["symbol"], c.Meta["line"], c.Meta["section_start"], c.Meta["section_end"], c.Text))
+	}
+	want := []string{
+		"A, B@1 0-0: package demo\n\nconst A = 1\nconst B = 2",
+		"C@5 1-1: const C = 3",
+		"Long@7 2-2: func Long() { println(1, 2, 3, 4, 5, 6) }",
+		"D@9 3-3: var D = 4",
+	}
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		t.Fatalf("chunks =\n%q\nwant\n%q", got, want)
+	}
+}
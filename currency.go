@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateTable holds exchange rates quoted against one base currency: Rates[c]
+// is how many units of c one unit of Base buys.
+type RateTable struct {
+	Base   string
+	AsOf   time.Time
+	Rates  map[string]float64
+	Source string
+}
+
+// RateSource produces a rate table. The file snapshot is the only source
+// today; a live feed can implement the same interface.
+type RateSource interface {
+	LoadRates(ctx context.Context) (*RateTable, error)
+}
+
+// currencyRates is the table behind convert_currency, set up in initRuntime.
+var currencyRates *RateTable
+
+// Conversion is the result of converting an amount, with the rate used.
+type Conversion struct {
+	Amount          float64 `json:"amount"`
+	From            string  `json:"from"`
+	To              string  `json:"to"`
+	AmountConverted float64 `json:"amount_converted"`
+	Currency        string  `json:"currency"`
+	Rate            float64 `json:"rate"`
+	Base            string  `json:"base"`
+	AsOf            string  `json:"as_of"`
+	Source          string  `json:"source"`
+}
+
+// Rate returns how many units of to one unit of from buys, crossing through
+// the base currency.
+func (t *RateTable) Rate(from, to string) (float64, error) {
+	from, err := normalizeCurrency(from)
+	if err != nil {
+		return 0, err
+	}
+	to, err = normalizeCurrency(to)
+	if err != nil {
+		return 0, err
+	}
+	fromRate, ok := t.Rates[from]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", from)
+	}
+	toRate, ok := t.Rates[to]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", to)
+	}
+	return toRate / fromRate, nil
+}
+
+// Convert converts amount and rounds the result to the target currency's
+// minor unit.
+func (t *RateTable) Convert(amount float64, from, to string) (Conversion, error) {
+	rate, err := t.Rate(from, to)
+	if err != nil {
+		return Conversion{}, err
+	}
+	from, _ = normalizeCurrency(from)
+	to, _ = normalizeCurrency(to)
+	return Conversion{
+		Amount:          amount,
+		From:            from,
+		To:              to,
+		AmountConverted: roundToMinorUnit(amount*rate, to),
+		Currency:        to,
+		Rate:            math.Round(rate*1e6) / 1e6,
+		Base:            t.Base,
+		AsOf:            t.AsOf.Format(dateLayout),
+		Source:          t.Source,
+	}, nil
+}
+
+// fileRateSource reads a rate snapshot from a JSON or CSV file. JSON files
+// look like {"base": "USD", "as_of": "2025-06-30", "rates": {"NGN": 1530.5}};
+// CSV files have the columns base,currency,rate,as_of.
+type fileRateSource struct {
+	path string
+}
+
+func (s fileRateSource) LoadRates(ctx context.Context) (*RateTable, error) {
+	var base, asOf string
+	rates := map[string]float64{}
+
+	switch strings.ToLower(filepath.Ext(s.path)) {
+	case ".json":
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return nil, err
+		}
+		var snap struct {
+			Base  string             `json:"base"`
+			AsOf  string             `json:"as_of"`
+			Rates map[string]float64 `json:"rates"`
+		}
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", s.path, err)
+		}
+		base, asOf, rates = snap.Base, snap.AsOf, snap.Rates
+	case ".csv":
+		f, err := os.Open(s.path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", s.path, err)
+		}
+		for i, rec := range records {
+			if i == 0 {
+				continue // header
+			}
+			if len(rec) < 4 {
+				return nil, fmt.Errorf("%s line %d: want base,currency,rate,as_of", s.path, i+1)
+			}
+			rate, err := strconv.ParseFloat(strings.TrimSpace(rec[2]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid rate %q", s.path, i+1, rec[2])
+			}
+			base, asOf = strings.TrimSpace(rec[0]), strings.TrimSpace(rec[3])
+			rates[strings.ToUpper(strings.TrimSpace(rec[1]))] = rate
+		}
+	default:
+		return nil, fmt.Errorf("unsupported rate file format %q (want .json or .csv)", filepath.Ext(s.path))
+	}
+
+	t := &RateTable{Rates: map[string]float64{}, Source: s.path}
+	var err error
+	if t.Base, err = normalizeCurrency(base); err != nil {
+		return nil, fmt.Errorf("%s: base: %w", s.path, err)
+	}
+	if t.AsOf, err = time.Parse(dateLayout, asOf); err != nil {
+		return nil, fmt.Errorf("%s: invalid as_of %q: want YYYY-MM-DD", s.path, asOf)
+	}
+	for code, rate := range rates {
+		c, err := normalizeCurrency(code)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.path, err)
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("%s: rate for %s must be positive", s.path, c)
+		}
+		t.Rates[c] = rate
+	}
+	t.Rates[t.Base] = 1
+	return t, nil
+}
+
+// normalizeCurrency upper-cases code and checks it is an ISO 4217 code.
+func normalizeCurrency(code string) (string, error) {
+	c := strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := iso4217MinorUnits[c]; !ok {
+		return "", fmt.Errorf("unknown currency code %q", code)
+	}
+	return c, nil
+}
+
+// roundToMinorUnit rounds amount to the number of decimals currency uses.
+func roundToMinorUnit(amount float64, currency string) float64 {
+	scale := math.Pow(10, float64(iso4217MinorUnits[currency]))
+	return math.Round(amount*scale) / scale
+}
+
+// iso4217MinorUnits lists active ISO 4217 currency codes with the number of
+// decimal places each uses.
+var iso4217MinorUnits = map[string]int{
+	"AED": 2, "AFN": 2, "ALL": 2, "AMD": 2, "ANG": 2, "AOA": 2, "ARS": 2, "AUD": 2,
+	"AWG": 2, "AZN": 2, "BAM": 2, "BBD": 2, "BDT": 2, "BGN": 2, "BHD": 3, "BIF": 0,
+	"BMD": 2, "BND": 2, "BOB": 2, "BRL": 2, "BSD": 2, "BTN": 2, "BWP": 2, "BYN": 2,
+	"BZD": 2, "CAD": 2, "CDF": 2, "CHF": 2, "CLP": 0, "CNY": 2, "COP": 2, "CRC": 2,
+	"CUP": 2, "CVE": 2, "CZK": 2, "DJF": 0, "DKK": 2, "DOP": 2, "DZD": 2, "EGP": 2,
+	"ERN": 2, "ETB": 2, "EUR": 2, "FJD": 2, "FKP": 2, "GBP": 2, "GEL": 2, "GHS": 2,
+	"GIP": 2, "GMD": 2, "GNF": 0, "GTQ": 2, "GYD": 2, "HKD": 2, "HNL": 2, "HTG": 2,
+	"HUF": 2, "IDR": 2, "ILS": 2, "INR": 2, "IQD": 3, "IRR": 2, "ISK": 0, "JMD": 2,
+	"JOD": 3, "JPY": 0, "KES": 2, "KGS": 2, "KHR": 2, "KMF": 0, "KPW": 2, "KRW": 0,
+	"KWD": 3, "KYD": 2, "KZT": 2, "LAK": 2, "LBP": 2, "LKR": 2, "LRD": 2, "LSL": 2,
+	"LYD": 3, "MAD": 2, "MDL": 2, "MGA": 2, "MKD": 2, "MMK": 2, "MNT": 2, "MOP": 2,
+	"MRU": 2, "MUR": 2, "MVR": 2, "MWK": 2, "MXN": 2, "MYR": 2, "MZN": 2, "NAD": 2,
+	"NGN": 2, "NIO": 2, "NOK": 2, "NPR": 2, "NZD": 2, "OMR": 3, "PAB": 2, "PEN": 2,
+	"PGK": 2, "PHP": 2, "PKR": 2, "PLN": 2, "PYG": 0, "QAR": 2, "RON": 2, "RSD": 2,
+	"RUB": 2, "RWF": 0, "SAR": 2, "SBD": 2, "SCR": 2, "SDG": 2, "SEK": 2, "SGD": 2,
+	"SHP": 2, "SLE": 2, "SOS": 2, "SRD": 2, "SSP": 2, "STN": 2, "SYP": 2, "SZL": 2,
+	"THB": 2, "TJS": 2, "TMT": 2, "TND": 3, "TOP": 2, "TRY": 2, "TTD": 2, "TWD": 2,
+	"TZS": 2, "UAH": 2, "UGX": 0, "USD": 2, "UYU": 2, "UZS": 2, "VES": 2, "VND": 0,
+	"VUV": 0, "WST": 2, "XAF": 0, "XCD": 2, "XOF": 0, "XPF": 0, "YER": 2, "ZAR": 2,
+	"ZMW": 2, "ZWL": 2,
+}
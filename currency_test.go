@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestRateTableConvert(t *testing.T) {
+	table := &RateTable{
+		Base:  "USD",
+		Rates: map[string]float64{"USD": 1, "EUR": 0.9, "JPY": 150, "BHD": 0.376},
+	}
+	cases := []struct {
+		amount   float64
+		from, to string
+		want     float64
+	}{
+		{100, "USD", "EUR", 90},
+		{90, "EUR", "USD", 100},
+		// Cross rates go through the base: 150 / 0.9 JPY per EUR.
+		{10, "EUR", "JPY", 1667},
+		{10, "eur", " jpy ", 1667},
+		// Minor units: JPY has none, USD two, BHD three.
+		{1000, "JPY", "USD", 6.67},
+		{12.345, "USD", "BHD", 4.642},
+		{1, "BHD", "JPY", 399},
+		{5, "JPY", "JPY", 5},
+	}
+	for _, tc := range cases {
+		got, err := table.Convert(tc.amount, tc.from, tc.to)
+		if err != nil {
+			t.Fatalf("Convert(%v, %q, %q): %v", tc.amount, tc.from, tc.to, err)
+		}
+		if got.AmountConverted != tc.want {
+			t.Fatalf("Convert(%v, %q, %q) = %v, want %v", tc.amount, tc.from, tc.to, got.AmountConverted, tc.want)
+		}
+	}
+
+	for _, pair := range [][2]string{{"USD", "GBP"}, {"XYZ", "USD"}, {"USD", ""}} {
+		if _, err := table.Convert(1, pair[0], pair[1]); err == nil {
+			t.Fatalf("Convert(1, %q, %q): expected error", pair[0], pair[1])
+		}
+	}
+}
+
+func TestRoundToMinorUnit(t *testing.T) {
+	cases := []struct {
+		amount   float64
+		currency string
+		want     float64
+	}{
+		{1234.5, "JPY", 1235},
+		{1234.4, "JPY", 1234},
+		{1.005001, "USD", 1.01},
+		{1.004, "USD", 1},
+		{1.0005, "BHD", 1.001},
+		{1.2344, "BHD", 1.234},
+	}
+	for _, tc := range cases {
+		if got := roundToMinorUnit(tc.amount, tc.currency); got != tc.want {
+			t.Fatalf("roundToMinorUnit(%v, %s) = %v, want %v", tc.amount, tc.currency, got, tc.want)
+		}
+	}
+}
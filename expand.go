@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// A retrieved chunk is often too short to answer from on its own. With
+// RAG_EXPAND set, queryInternalKnowledge widens each document hit to the
+// chunks around it or to its whole section, found through the source and
+// chunk index every rag_docs chunk records, and merges the windows of hits
+// from the same source. RAG_CONTEXT_BUDGET caps how much text that adds.
+
+const (
+	expandNone       = "none"
+	expandNeighbours = "neighbours"
+	expandSection    = "section"
+)
+
+// chunkWindow is the range of chunks of one source a hit may expand to.
+type chunkWindow struct {
+	source      string
+	chunk       int // the hit itself
+	first, last int
+	expandable  bool
+}
+
+// expandWindow returns the window hit r may expand to: n chunks either side
+// in neighbours mode, or the section range recorded at ingestion in section
+// mode (falling back to n neighbours for chunks indexed without one).
+func expandWindow(r Retrieved, mode string, n int) chunkWindow {
+	i, ok := metaInt(r.Meta, "chunk")
+	if !ok || r.Source == "" {
+		return chunkWindow{}
+	}
+	w := chunkWindow{source: r.Source, chunk: i, first: max(i-n, 0), last: i + n, expandable: true}
+	if mode == expandSection {
+		start, okStart := metaInt(r.Meta, "section_start")
+		end, okEnd := metaInt(r.Meta, "section_end")
+		if okStart && okEnd && start <= i && i <= end {
+			w.first, w.last = start, end
+		}
+	}
+	return w
+}
+
+// expandRetrieved replaces document hits with the text of the consecutive
+// chunks around them. Hits are expanded in rank order, nearest chunks first,
+// until the text of all results would exceed budget bytes (0 means no
+// limit); the hits themselves are always kept. Hits from the same source
+// whose windows meet become one result, in the place of the best-ranked of
+// them. Each expanded result records the chunk range it covers as
+// "chunk_first" and "chunk_last".
+func expandRetrieved(ctx context.Context, c chroma.Collection, hits []Retrieved, mode string, n, budget int) ([]Retrieved, error) {
+	switch mode {
+	case expandNone, "":
+		return hits, nil
+	case expandNeighbours, "neighbors", expandSection:
+	default:
+		return hits, fmt.Errorf("unknown RAG_EXPAND mode %q (want %s, %s or %s)", mode, expandNone, expandNeighbours, expandSection)
+	}
+
+	windows := make([]chunkWindow, len(hits))
+	chunks := map[string]Retrieved{}
+	var ids []string
+	for i, h := range hits {
+		windows[i] = expandWindow(h, mode, n)
+		chunks[h.ID] = h
+	}
+	for _, w := range windows {
+		if !w.expandable {
+			continue
+		}
+		for j := w.first; j <= w.last; j++ {
+			if id := ragChunkID(w.source, j); chunks[id].ID == "" {
+				chunks[id] = Retrieved{ID: id}
+				ids = append(ids, id)
+			}
+		}
+	}
+	fetched, err := chromaGetByIDs(ctx, c, ids)
+	if err != nil {
+		return hits, fmt.Errorf("fetching neighbouring chunks: %w", err)
+	}
+	for _, r := range fetched {
+		chunks[r.ID] = r
+	}
+	return mergeWindows(hits, windows, chunks, budget), nil
+}
+
+// mergeWindows grows each hit within its window over the chunks that exist,
+// within budget, and joins each run of consecutive chunks into one result.
+func mergeWindows(hits []Retrieved, windows []chunkWindow, chunks map[string]Retrieved, budget int) []Retrieved {
+	included := map[string]map[int]bool{}
+	has := func(source string, i int) bool { return included[source][i] }
+	include := func(source string, i int) {
+		if included[source] == nil {
+			included[source] = map[int]bool{}
+		}
+		included[source][i] = true
+	}
+
+	used := 0
+	for i, h := range hits {
+		if w := windows[i]; w.expandable {
+			include(w.source, w.chunk)
+		}
+		used += len(h.Text)
+	}
+
+	for _, w := range windows {
+		if !w.expandable {
+			continue
+		}
+	grow:
+		for d := 1; w.chunk-d >= w.first || w.chunk+d <= w.last; d++ {
+			for _, j := range []int{w.chunk - d, w.chunk + d} {
+				if j < w.first || j > w.last || has(w.source, j) {
+					continue
+				}
+				text := chunks[ragChunkID(w.source, j)].Text
+				if text == "" {
+					continue
+				}
+				if budget > 0 && used+len(text) > budget {
+					break grow
+				}
+				include(w.source, j)
+				used += len(text)
+			}
+		}
+	}
+
+	var out []Retrieved
+	emitted := map[string]bool{}
+	for i, h := range hits {
+		w := windows[i]
+		if !w.expandable {
+			out = append(out, h)
+			continue
+		}
+		first, last := w.chunk, w.chunk
+		for has(w.source, first-1) {
+			first--
+		}
+		for has(w.source, last+1) {
+			last++
+		}
+		key := fmt.Sprintf("%s#%d", w.source, first)
+		if emitted[key] {
+			continue
+		}
+		emitted[key] = true
+		if first == last {
+			out = append(out, h)
+			continue
+		}
+
+		run := make([]Retrieved, 0, last-first+1)
+		for j := first; j <= last; j++ {
+			if j == w.chunk {
+				run = append(run, h)
+			} else {
+				run = append(run, chunks[ragChunkID(w.source, j)])
+			}
+		}
+		meta := make(map[string]interface{}, len(h.Meta)+2)
+		for k, v := range h.Meta {
+			meta[k] = v
+		}
+		meta["chunk_first"] = first
+		meta["chunk_last"] = last
+		out = append(out, Retrieved{ID: h.ID, Text: joinChunks(run), Source: h.Source, Meta: meta, Score: h.Score})
+	}
+	return out
+}
+
+// joinChunks joins consecutive chunks of one source. Within a section it
+// drops the heading line each chunk repeats and the text a chunk overlaps
+// with the one before it.
+func joinChunks(run []Retrieved) string {
+	var b strings.Builder
+	var prevBody string
+	prevSection := -1
+	for i, r := range run {
+		section, ok := metaInt(r.Meta, "section_start")
+		if !ok {
+			section = -1
+		}
+		sameSection := i > 0 && section >= 0 && section == prevSection
+
+		body := r.Text
+		if heading, _ := r.Meta["heading_path"].(string); heading != "" && sameSection {
+			if first, rest, found := strings.Cut(body, "\n"); found && strings.HasSuffix(heading, first) {
+				body = rest
+			}
+		}
+		switch {
+		case i == 0:
+		case sameSection:
+			body = trimOverlap(prevBody, body)
+			if body != "" {
+				b.WriteString("\n")
+			}
+		default:
+			b.WriteString("\n\n")
+		}
+		b.WriteString(body)
+		if body != "" || !sameSection {
+			prevBody = body
+		}
+		prevSection = section
+	}
+	return b.String()
+}
+
+// trimOverlap drops the longest run of whole words next starts with that
+// prev ends with.
+func trimOverlap(prev, next string) string {
+	for k := min(len(prev), len(next)); k > 0; k-- {
+		if k < len(next) && !isSpaceByte(next[k]) {
+			continue
+		}
+		if k < len(prev) && !isSpaceByte(prev[len(prev)-k-1]) {
+			continue
+		}
+		if strings.HasSuffix(prev, next[:k]) {
+			return strings.TrimLeft(next[k:], " \t\r\n")
+		}
+	}
+	return next
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// metaInt reads an integer metadata value; numbers come back from Chroma as
+// float64.
+func metaInt(meta map[string]interface{}, key string) (int, bool) {
+	switch v := meta[key].(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// docChunk is chunk i of source, as it comes back from Chroma.
+func docChunk(source string, i int) Retrieved {
+	return Retrieved{
+		ID:     ragChunkID(source, i),
+		Text:   fmt.Sprintf("chunk %d.", i),
+		Source: source,
+		Meta:   map[string]interface{}{"chunk": float64(i)},
+	}
+}
+
+func TestMergeWindows(t *testing.T) {
+	chunks := map[string]Retrieved{}
+	for i := 0; i < 5; i++ {
+		if i != 4 {
+			chunks[ragChunkID("a.md", i)] = docChunk("a.md", i)
+		}
+		chunks[ragChunkID("b.md", i)] = docChunk("b.md", i)
+	}
+	tool := Retrieved{ID: "tool", Text: "tool text"} // 9 bytes, not expandable
+
+	// Every chunk text is 8 bytes long.
+	cases := []struct {
+		name   string
+		hits   []Retrieved
+		n      int
+		budget int
+		want   []string // "ID first-last: text" per result
+	}{
+		{
+			name: "neighbours",
+			hits: []Retrieved{docChunk("a.md", 2)},
+			n:    1,
+			want: []string{"a.md#2 1-3: chunk 1.\n\nchunk 2.\n\nchunk 3."},
+		},
+		{
+			name: "window stops at the first and a missing chunk",
+			hits: []Retrieved{docChunk("a.md", 0), docChunk("a.md", 3)},
+			n:    2,
+			want: []string{"a.md#0 0-3: chunk 0.\n\nchunk 1.\n\nchunk 2.\n\nchunk 3."},
+		},
+		{
+			name: "two hits from one source merge in the place of the first",
+			hits: []Retrieved{docChunk("b.md", 3), tool, docChunk("a.md", 1), docChunk("b.md", 1)},
+			n:    1,
+			want: []string{
+				"b.md#3 0-4: chunk 0.\n\nchunk 1.\n\nchunk 2.\n\nchunk 3.\n\nchunk 4.",
+				"tool: tool text",
+				"a.md#1 0-2: chunk 0.\n\nchunk 1.\n\nchunk 2.",
+			},
+		},
+		{
+			name:   "budget fits both neighbours",
+			hits:   []Retrieved{docChunk("b.md", 2)},
+			n:      2,
+			budget: 24,
+			want:   []string{"b.md#2 1-3: chunk 1.\n\nchunk 2.\n\nchunk 3."},
+		},
+		{
+			name:   "budget cuts off nearest first",
+			hits:   []Retrieved{tool, docChunk("b.md", 2)},
+			n:      2,
+			budget: 9 + 8 + 8 + 7,
+			want:   []string{"tool: tool text", "b.md#2 1-2: chunk 1.\n\nchunk 2."},
+		},
+		{
+			name:   "hits are kept over budget",
+			hits:   []Retrieved{docChunk("b.md", 2), docChunk("a.md", 0)},
+			n:      1,
+			budget: 1,
+			want:   []string{"b.md#2: chunk 2.", "a.md#0: chunk 0."},
+		},
+	}
+	for _, tc := range cases {
+		windows := make([]chunkWindow, len(tc.hits))
+		for i, h := range tc.hits {
+			windows[i] = expandWindow(h, expandNeighbours, tc.n)
+		}
+		var got []string
+		for _, r := range mergeWindows(tc.hits, windows, chunks, tc.budget) {
+			label := r.ID
+			if i, ok := metaInt(r.Meta, "chunk"); ok {
+				label = fmt.Sprintf("%s#%d", r.Source, i)
+			}
+			if first, ok := metaInt(r.Meta, "chunk_first"); ok {
+				last, _ := metaInt(r.Meta, "chunk_last")
+				label += fmt.Sprintf(" %d-%d", first, last)
+			}
+			got = append(got, label+": "+r.Text)
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tc.want) {
+			t.Fatalf("%s:\ngot  %q\nwant %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestExpandWindowSection(t *testing.T) {
+	r := docChunk("a.md", 5)
+	r.Meta["section_start"] = float64(3)
+	r.Meta["section_end"] = float64(9)
+	if w := expandWindow(r, expandSection, 1); w.first != 3 || w.last != 9 {
+		t.Fatalf("section window = %d-%d, want 3-9", w.first, w.last)
+	}
+	// A section range that does not contain the chunk falls back to neighbours.
+	r.Meta["section_start"] = float64(6)
+	if w := expandWindow(r, expandSection, 1); w.first != 4 || w.last != 6 {
+		t.Fatalf("fallback window = %d-%d, want 4-6", w.first, w.last)
+	}
+	if w := expandWindow(Retrieved{ID: "tool", Text: "x"}, expandSection, 1); w.expandable {
+		t.Fatalf("hit without a chunk index is expandable: %+v", w)
+	}
+}
+
+func TestJoinChunks(t *testing.T) {
+	chunk := func(section int, heading, text string) Retrieved {
+		meta := map[string]interface{}{"section_start": float64(section)}
+		if heading != "" {
+			meta["heading_path"] = heading
+		}
+		return Retrieved{Text: text, Meta: meta}
+	}
+	cases := []struct {
+		name string
+		run  []Retrieved
+		want string
+	}{
+		{
+			name: "repeated heading and overlap dropped",
+			run: []Retrieved{
+				chunk(0, "Guide > Setup", "Guide > Setup\nOne. Two."),
+				chunk(0, "Guide > Setup", "Guide > Setup\nTwo. Three."),
+			},
+			want: "Guide > Setup\nOne. Two.\nThree.",
+		},
+		{
+			name: "shortened heading dropped too",
+			run: []Retrieved{
+				chunk(0, "Guide > Setup", "Setup\nOne."),
+				chunk(0, "Guide > Setup", "Setup\nTwo."),
+			},
+			want: "Setup\nOne.\nTwo.",
+		},
+		{
+			name: "chunk wholly overlapped",
+			run: []Retrieved{
+				chunk(0, "H", "H\nOne. Two."),
+				chunk(0, "H", "H\nTwo."),
+				chunk(0, "H", "H\nTwo. Three."),
+			},
+			want: "H\nOne. Two.\nThree.",
+		},
+		{
+			name: "new section keeps its heading",
+			run: []Retrieved{
+				chunk(0, "Guide > Setup", "Guide > Setup\nOne."),
+				chunk(1, "Guide > Use", "Guide > Use\nOne."),
+			},
+			want: "Guide > Setup\nOne.\n\nGuide > Use\nOne.",
+		},
+		{
+			name: "no section metadata",
+			run:  []Retrieved{{Text: "a b"}, {Text: "b c"}},
+			want: "a b\n\nb c",
+		},
+	}
+	for _, tc := range cases {
+		if got := joinChunks(tc.run); got != tc.want {
+			t.Fatalf("%s: joinChunks = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTrimOverlap(t *testing.T) {
+	cases := []struct{ prev, next, want string }{
+		{"one two three", "two three four", "four"},
+		{"One. Two.", "Two.\nThree.", "Three."},
+		// Only whole words count.
+		{"one two", "wo three", "wo three"},
+		{"one two", "two2 three", "two2 three"},
+		{"same", "same", ""},
+		{"", "next", "next"},
+		{"a b", "c d", "c d"},
+	}
+	for _, tc := range cases {
+		if got := trimOverlap(tc.prev, tc.next); got != tc.want {
+			t.Fatalf("trimOverlap(%q, %q) = %q, want %q", tc.prev, tc.next, got, tc.want)
+		}
+	}
+}
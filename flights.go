@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout is the YYYY-MM-DD format tools accept for dates.
+const dateLayout = "2006-01-02"
+
+// FlightQuery selects flights on one route. Origin and Destination match an
+// airport code or city name, case-insensitively. A zero Date lists every
+// scheduled option regardless of the day it operates.
+type FlightQuery struct {
+	Origin      string
+	Destination string
+	Date        time.Time
+}
+
+// FlightOption is one bookable flight. Departure and Arrival are local times;
+// they are full timestamps when the query had a date and "HH:MM" otherwise.
+type FlightOption struct {
+	Carrier         string   `json:"carrier"`
+	FlightNumber    string   `json:"flight_number"`
+	Origin          string   `json:"origin"`
+	OriginCity      string   `json:"origin_city,omitempty"`
+	Destination     string   `json:"destination"`
+	DestinationCity string   `json:"destination_city,omitempty"`
+	Departure       string   `json:"departure"`
+	Arrival         string   `json:"arrival"`
+	DurationMinutes int      `json:"duration_minutes"`
+	Stops           int      `json:"stops"`
+	Via             []string `json:"via,omitempty"`
+	FareClass       string   `json:"fare_class"`
+	PriceUSD        float64  `json:"price_usd"`
+	Days            string   `json:"days,omitempty"`
+}
+
+// FlightProvider looks up flights. The file-backed provider serves offline
+// runs; an HTTP provider can implement the same interface.
+type FlightProvider interface {
+	SearchFlights(ctx context.Context, q FlightQuery) ([]FlightOption, error)
+}
+
+// flightProvider is the provider behind get_flight_schedule, set up in
+// initRuntime.
+var flightProvider FlightProvider
+
+// scheduledFlight is one row of a flight schedule dataset: a flight that
+// operates on the given weekdays at a fixed local departure time.
+type scheduledFlight struct {
+	Carrier         string   `json:"carrier"`
+	FlightNumber    string   `json:"flight_number"`
+	Origin          string   `json:"origin"`
+	OriginCity      string   `json:"origin_city"`
+	Destination     string   `json:"destination"`
+	DestinationCity string   `json:"destination_city"`
+	Departure       string   `json:"departure"` // HH:MM local
+	DurationMinutes int      `json:"duration_minutes"`
+	Days            string   `json:"days"` // e.g. "Mon,Wed,Fri"; empty means daily
+	Stops           int      `json:"stops"`
+	Via             []string `json:"via"`
+	FareClass       string   `json:"fare_class"`
+	PriceUSD        float64  `json:"price_usd"`
+
+	depMinutes int
+	weekdays   map[time.Weekday]bool // nil means daily
+}
+
+// fileFlightProvider serves a schedule loaded from a JSON or CSV file.
+type fileFlightProvider struct {
+	flights []scheduledFlight
+}
+
+// newFileFlightProvider loads a schedule from path. JSON files hold an array
+// of flights; CSV files have a header row naming the same fields (via is
+// separated by "|").
+func newFileFlightProvider(path string) (*fileFlightProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var flights []scheduledFlight
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(f).Decode(&flights); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", path, err)
+		}
+	case ".csv":
+		flights, err = readFlightsCSV(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported flight data format %q (want .json or .csv)", filepath.Ext(path))
+	}
+
+	for i := range flights {
+		if err := flights[i].prepare(); err != nil {
+			return nil, fmt.Errorf("%s: flight %d (%s): %w", path, i+1, flights[i].FlightNumber, err)
+		}
+	}
+	return &fileFlightProvider{flights: flights}, nil
+}
+
+func readFlightsCSV(r io.Reader) ([]scheduledFlight, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	col := map[string]int{}
+	for i, name := range records[0] {
+		col[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	get := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	flights := make([]scheduledFlight, 0, len(records)-1)
+	for line, rec := range records[1:] {
+		fl := scheduledFlight{
+			Carrier:         get(rec, "carrier"),
+			FlightNumber:    get(rec, "flight_number"),
+			Origin:          get(rec, "origin"),
+			OriginCity:      get(rec, "origin_city"),
+			Destination:     get(rec, "destination"),
+			DestinationCity: get(rec, "destination_city"),
+			Departure:       get(rec, "departure"),
+			Days:            get(rec, "days"),
+			FareClass:       get(rec, "fare_class"),
+		}
+		if via := get(rec, "via"); via != "" {
+			fl.Via = strings.Split(via, "|")
+		}
+		if fl.DurationMinutes, err = atoiField(get(rec, "duration_minutes")); err != nil {
+			return nil, fmt.Errorf("line %d: duration_minutes: %w", line+2, err)
+		}
+		if fl.Stops, err = atoiField(get(rec, "stops")); err != nil {
+			return nil, fmt.Errorf("line %d: stops: %w", line+2, err)
+		}
+		if fl.PriceUSD, err = strconv.ParseFloat(get(rec, "price_usd"), 64); err != nil {
+			return nil, fmt.Errorf("line %d: price_usd: %w", line+2, err)
+		}
+		flights = append(flights, fl)
+	}
+	return flights, nil
+}
+
+func atoiField(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// prepare parses the departure time and operating days.
+func (f *scheduledFlight) prepare() error {
+	t, err := time.Parse("15:04", f.Departure)
+	if err != nil {
+		return fmt.Errorf("invalid departure %q: want HH:MM", f.Departure)
+	}
+	f.depMinutes = t.Hour()*60 + t.Minute()
+	if f.DurationMinutes <= 0 {
+		return errors.New("duration_minutes must be positive")
+	}
+
+	days := strings.TrimSpace(f.Days)
+	if days == "" || strings.EqualFold(days, "daily") {
+		return nil
+	}
+	f.weekdays = map[time.Weekday]bool{}
+	for _, d := range strings.Split(days, ",") {
+		wd, ok := parseWeekday(d)
+		if !ok {
+			return fmt.Errorf("invalid day %q in %q", d, f.Days)
+		}
+		f.weekdays[wd] = true
+	}
+	return nil
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) < 3 {
+		return 0, false
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.HasPrefix(strings.ToLower(d.String()), s[:3]) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// servesPlace reports whether a flight endpoint matches the requested place,
+// given as an airport code or a city name.
+func servesPlace(code, city, place string) bool {
+	place = strings.TrimSpace(place)
+	return strings.EqualFold(code, place) || (city != "" && strings.EqualFold(city, place))
+}
+
+func (p *fileFlightProvider) SearchFlights(ctx context.Context, q FlightQuery) ([]FlightOption, error) {
+	var out []FlightOption
+	for _, f := range p.flights {
+		if !servesPlace(f.Origin, f.OriginCity, q.Origin) || !servesPlace(f.Destination, f.DestinationCity, q.Destination) {
+			continue
+		}
+		if !q.Date.IsZero() && f.weekdays != nil && !f.weekdays[q.Date.Weekday()] {
+			continue
+		}
+
+		opt := FlightOption{
+			Carrier:         f.Carrier,
+			FlightNumber:    f.FlightNumber,
+			Origin:          f.Origin,
+			OriginCity:      f.OriginCity,
+			Destination:     f.Destination,
+			DestinationCity: f.DestinationCity,
+			DurationMinutes: f.DurationMinutes,
+			Stops:           f.Stops,
+			Via:             f.Via,
+			FareClass:       f.FareClass,
+			PriceUSD:        f.PriceUSD,
+		}
+		// Arrival is departure plus flight time on the departure clock; the
+		// dataset does not model time zones.
+		if q.Date.IsZero() {
+			opt.Departure = f.Departure
+			opt.Arrival = clockTime(f.depMinutes + f.DurationMinutes)
+			opt.Days = f.Days
+		} else {
+			dep := q.Date.Add(time.Duration(f.depMinutes) * time.Minute)
+			opt.Departure = dep.Format("2006-01-02T15:04")
+			opt.Arrival = dep.Add(time.Duration(f.DurationMinutes) * time.Minute).Format("2006-01-02T15:04")
+		}
+		out = append(out, opt)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].PriceUSD != out[j].PriceUSD {
+			return out[i].PriceUSD < out[j].PriceUSD
+		}
+		return out[i].Departure < out[j].Departure
+	})
+	return out, nil
+}
+
+// clockTime formats minutes since midnight as HH:MM, with a "+N" day suffix
+// past midnight.
+func clockTime(minutes int) string {
+	s := fmt.Sprintf("%02d:%02d", minutes%(24*60)/60, minutes%60)
+	if days := minutes / (24 * 60); days > 0 {
+		s += fmt.Sprintf("+%d", days)
+	}
+	return s
+}
+
+// parseDate parses an optional YYYY-MM-DD date; empty gives the zero time.
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: want YYYY-MM-DD", s)
+	}
+	return t, nil
+}
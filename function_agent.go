@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"google.golang.org/genai"
+)
+
+// LLM backends selected with --backend / LLM_BACKEND.
+const (
+	backendOpenRouter = "openrouter"
+	backendGemini     = "gemini"
+)
+
+const toolAgentSystemPrompt = `You are a travel assistant. Use the available tools to look up flights, hotels, currency conversions and internal knowledge whenever they can help, and base your answer on their results. When you have everything you need, reply to the user directly.`
+
+// toolCallingModel is an LLM backend with native tool/function calling. It
+// takes the whole transcript and returns either tool calls or a final answer.
+type toolCallingModel interface {
+	generateWithTools(ctx context.Context, msgs []llms.MessageContent) (*llms.ContentChoice, error)
+}
+
+// toolModel is the backend used by the tools agent, set up in initRuntime.
+var toolModel toolCallingModel
+
+// runToolAgent answers prompt with native tool calling. Tool arguments arrive
+// as JSON and are validated against the tool's registry schema before the
+// tool runs; validation and tool errors are returned to the model so it can
+// retry.
+// With stream.Verbose set, each tool call is shown dimmed on stream.Out.
+func runToolAgent(ctx context.Context, session Session, history []llms.ChatMessage, prompt string, stream streamOptions) (string, error) {
+	if toolModel == nil {
+		return "", errors.New("tool-calling backend not initialized")
+	}
+
+	msgs := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, toolAgentSystemPrompt)}
+	for _, m := range recentHistory(history) {
+		msgs = append(msgs, llms.TextParts(m.GetType(), m.GetContent()))
+	}
+	msgs = append(msgs, llms.TextParts(llms.ChatMessageTypeHuman, prompt))
+
+	for i := 0; i < agentMaxIterations; i++ {
+		choice, err := toolModel.generateWithTools(ctx, msgs)
+		if err != nil {
+			return "", err
+		}
+		if len(choice.ToolCalls) == 0 {
+			return strings.TrimSpace(choice.Content), nil
+		}
+
+		assistant := llms.MessageContent{Role: llms.ChatMessageTypeAI}
+		if choice.Content != "" {
+			assistant.Parts = append(assistant.Parts, llms.TextContent{Text: choice.Content})
+		}
+		for _, call := range choice.ToolCalls {
+			assistant.Parts = append(assistant.Parts, call)
+		}
+		msgs = append(msgs, assistant)
+
+		for _, call := range choice.ToolCalls {
+			if stream.Verbose && stream.Out != nil {
+				fmt.Fprintf(stream.Out, "%s→ %s %s%s\n", ansiDim, call.FunctionCall.Name, call.FunctionCall.Arguments, ansiReset)
+			}
+			msgs = append(msgs, llms.MessageContent{
+				Role: llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{llms.ToolCallResponse{
+					ToolCallID: call.ID,
+					Name:       call.FunctionCall.Name,
+					Content:    callTool(ctx, session, call),
+				}},
+			})
+		}
+	}
+	return "", fmt.Errorf("agent did not reach a final answer within %d steps", agentMaxIterations)
+}
+
+// callTool runs one tool call and returns what the model should see: the
+// tool's output, or an error message describing what to fix.
+func callTool(ctx context.Context, session Session, call llms.ToolCall) string {
+	if call.FunctionCall == nil {
+		return "Error: tool call has no function"
+	}
+	def := agentToolRegistry.Lookup(call.FunctionCall.Name)
+	if def == nil {
+		return fmt.Sprintf("Error: unknown tool %q", call.FunctionCall.Name)
+	}
+	return def.run(ctx, session, call.FunctionCall.Arguments)
+}
+
+// ------------------
+// OpenRouter backend
+// ------------------
+
+// openRouterToolModel sends the tools to an OpenAI-compatible endpoint as
+// "tools" with JSON Schema parameters.
+type openRouterToolModel struct {
+	llm   llms.Model
+	tools []llms.Tool
+}
+
+func newOpenRouterToolModel(llm llms.Model) openRouterToolModel {
+	return openRouterToolModel{llm: llm, tools: agentToolRegistry.OpenAITools()}
+}
+
+func (m openRouterToolModel) generateWithTools(ctx context.Context, msgs []llms.MessageContent) (*llms.ContentChoice, error) {
+	resp, err := m.llm.GenerateContent(ctx, msgs, llms.WithTools(m.tools))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("model returned no choices")
+	}
+	return resp.Choices[0], nil
+}
+
+// ------------------
+// Gemini backend
+// ------------------
+
+// geminiToolModel calls the Gemini API with genAiTools as function
+// declarations.
+type geminiToolModel struct {
+	client *genai.Client
+	model  string
+}
+
+func newGeminiToolModel(ctx context.Context, apiKey, model string) (geminiToolModel, error) {
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return geminiToolModel{}, fmt.Errorf("creating Gemini client: %w", err)
+	}
+	return geminiToolModel{client: client, model: model}, nil
+}
+
+func (m geminiToolModel) generateWithTools(ctx context.Context, msgs []llms.MessageContent) (*llms.ContentChoice, error) {
+	system, contents, err := genaiContents(msgs)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Models.GenerateContent(ctx, m.model, contents, &genai.GenerateContentConfig{
+		SystemInstruction: system,
+		Tools:             genAiTools,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	choice := &llms.ContentChoice{Content: resp.Text()}
+	for i, fc := range resp.FunctionCalls() {
+		args, err := json.Marshal(fc.Args)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s arguments: %w", fc.Name, err)
+		}
+		id := fc.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+		choice.ToolCalls = append(choice.ToolCalls, llms.ToolCall{
+			ID:           id,
+			Type:         "function",
+			FunctionCall: &llms.FunctionCall{Name: fc.Name, Arguments: string(args)},
+		})
+	}
+	return choice, nil
+}
+
+// genaiContents converts a langchaingo transcript to Gemini contents. The
+// system message becomes the system instruction; tool results are sent back
+// as function responses from the user.
+func genaiContents(msgs []llms.MessageContent) (*genai.Content, []*genai.Content, error) {
+	var system *genai.Content
+	var contents []*genai.Content
+	for _, m := range msgs {
+		var parts []*genai.Part
+		for _, p := range m.Parts {
+			switch p := p.(type) {
+			case llms.TextContent:
+				parts = append(parts, &genai.Part{Text: p.Text})
+			case llms.ToolCall:
+				var args map[string]any
+				if err := json.Unmarshal([]byte(p.FunctionCall.Arguments), &args); err != nil {
+					return nil, nil, fmt.Errorf("decoding %s arguments: %w", p.FunctionCall.Name, err)
+				}
+				parts = append(parts, &genai.Part{FunctionCall: &genai.FunctionCall{Name: p.FunctionCall.Name, Args: args}})
+			case llms.ToolCallResponse:
+				parts = append(parts, &genai.Part{FunctionResponse: &genai.FunctionResponse{
+					Name:     p.Name,
+					Response: map[string]any{"output": p.Content},
+				}})
+			}
+		}
+
+		switch m.Role {
+		case llms.ChatMessageTypeSystem:
+			system = genai.NewContentFromParts(parts, genai.RoleUser)
+		case llms.ChatMessageTypeAI:
+			contents = append(contents, genai.NewContentFromParts(parts, genai.RoleModel))
+		default:
+			contents = append(contents, genai.NewContentFromParts(parts, genai.RoleUser))
+		}
+	}
+	return system, contents, nil
+}
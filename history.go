@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConversationTurn is one stored user/assistant exchange.
+type ConversationTurn struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	Session   string    `json:"session"`
+	UserID    string    `json:"user"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// HistoryOptions selects which turns listConversationHistory returns.
+// Session limits the listing to the user's turns in that session, or in all
+// of the user's sessions if it is CrossSession; Since drops turns older than
+// the given time; Last then keeps only the most recent N turns. Zero values
+// of Since and Last disable those filters.
+type HistoryOptions struct {
+	Session Session
+	Last    int
+	Since   time.Time
+}
+
+// listConversationHistory pages through every turn in conversation_memory and
+// returns the selected ones in chronological order, ordered by the stored
+// "timestamp" metadata.
+func listConversationHistory(ctx context.Context, opts HistoryOptions) ([]ConversationTurn, error) {
+	if conversationCollection == nil {
+		return []ConversationTurn{}, nil
+	}
+
+	filter := opts.Session.memoryFilter()
+	var turns []ConversationTurn
+	err := chromaForEach(ctx, conversationCollection, filter.where(), func(id, doc string, meta map[string]interface{}) error {
+		text := strings.TrimSpace(doc)
+		if text == "" {
+			return nil
+		}
+		ts := parseTurnTimestamp(meta["timestamp"])
+		if !opts.Since.IsZero() && ts.Before(opts.Since) {
+			return nil
+		}
+		turn := ConversationTurn{ID: id, Text: text, Timestamp: ts}
+		turn.Session, _ = meta["session"].(string)
+		turn.UserID, _ = meta["user"].(string)
+		turns = append(turns, turn)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortTurns(turns)
+	if opts.Last > 0 && len(turns) > opts.Last {
+		turns = turns[len(turns)-opts.Last:]
+	}
+	return turns, nil
+}
+
+// sortTurns orders turns chronologically. Turns without a usable timestamp
+// sort first; IDs break ties so the order is stable across runs.
+func sortTurns(turns []ConversationTurn) {
+	sort.Slice(turns, func(i, j int) bool {
+		if !turns[i].Timestamp.Equal(turns[j].Timestamp) {
+			return turns[i].Timestamp.Before(turns[j].Timestamp)
+		}
+		return turns[i].ID < turns[j].ID
+	})
+}
+
+// parseTurnTimestamp accepts the RFC3339Nano timestamps written by
+// storeConversationHistory as well as the second-precision RFC3339 ones from
+// older versions.
+func parseTurnTimestamp(v interface{}) time.Time {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// sinceDays matches a duration with a leading number of days, as in "7d" or
+// "1d12h", which time.ParseDuration does not accept.
+var sinceDays = regexp.MustCompile(`^(\d+)d(.*)$`)
+
+// parseSince interprets s as either an RFC3339 timestamp or a duration
+// before now (e.g. "72h", "7d" or "1d12h"). Negative durations, which would
+// name a time in the future, are rejected.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+
+	var d time.Duration
+	rest := s
+	if m := sinceDays.FindStringSubmatch(s); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q: %w", s, err)
+		}
+		d, rest = time.Duration(days)*24*time.Hour, m[2]
+	}
+	if rest != "" {
+		more, err := time.ParseDuration(rest)
+		if err != nil || (rest != s && strings.HasPrefix(rest, "-")) {
+			return time.Time{}, fmt.Errorf("invalid time %q: want RFC3339 timestamp or duration like 24h or 7d", s)
+		}
+		d += more
+	}
+	if d < 0 {
+		return time.Time{}, fmt.Errorf("invalid time %q: duration must not be negative", s)
+	}
+	return now.Add(-d), nil
+}
+
+// forgetTurns deletes the given turns from conversation_memory and its BM25
+// index. IDs that are not stored turns are returned as missing rather than
+// failing the call.
+func forgetTurns(ctx context.Context, ids []string) (removed, missing []string, err error) {
+	if conversationCollection == nil {
+		return nil, nil, fmt.Errorf("conversationCollection not initialized")
+	}
+	found, err := chromaGetByIDs(ctx, conversationCollection, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	stored := make(map[string]bool, len(found))
+	for _, r := range found {
+		stored[r.ID] = true
+	}
+	for _, id := range ids {
+		if stored[id] {
+			removed = append(removed, id)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if err := deleteTurns(ctx, removed); err != nil {
+		return nil, missing, err
+	}
+	return removed, missing, nil
+}
+
+// forgetSession deletes every turn the session's user stored under it and
+// returns their IDs.
+func forgetSession(ctx context.Context, session Session) ([]string, error) {
+	if conversationCollection == nil {
+		return nil, fmt.Errorf("conversationCollection not initialized")
+	}
+	var ids []string
+	err := chromaForEach(ctx, conversationCollection, Session{ID: session.ID, UserID: session.UserID}.memoryFilter().where(), func(id, _ string, _ map[string]interface{}) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := deleteTurns(ctx, ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func deleteTurns(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := chromaDeleteIDs(ctx, conversationCollection, ids); err != nil {
+		return fmt.Errorf("deleting turns: %w", err)
+	}
+	lexical := lexicalIndex(conversationCollection)
+	lexical.Remove(ids...)
+	saveBM25Index(lexical, conversationCollection)
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"", time.Time{}, true},
+		{"2025-06-01T08:00:00Z", time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC), true},
+		{"2025-06-01T08:00:00.5+02:00", time.Date(2025, 6, 1, 6, 0, 0, 5e8, time.UTC), true},
+		{"72h", now.Add(-72 * time.Hour), true},
+		{" 90m ", now.Add(-90 * time.Minute), true},
+		{"7d", now.AddDate(0, 0, -7), true},
+		{"1d12h", now.Add(-36 * time.Hour), true},
+		{"0d", now, true},
+		{"-24h", time.Time{}, false},
+		{"-7d", time.Time{}, false},
+		{"1d-1h", time.Time{}, false},
+		{"7days", time.Time{}, false},
+		{"d", time.Time{}, false},
+		{"2025-06-01", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+	for _, tc := range cases {
+		got, err := parseSince(tc.in, now)
+		if (err == nil) != tc.ok || !got.Equal(tc.want) {
+			t.Fatalf("parseSince(%q) = %v, %v; want %v, ok %v", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestSortTurns(t *testing.T) {
+	at := func(min int) time.Time { return time.Date(2025, 6, 30, 12, min, 0, 0, time.UTC) }
+	turns := []ConversationTurn{
+		{ID: "c", Timestamp: at(5)},
+		{ID: "b", Timestamp: at(1)},
+		{ID: "z"}, // no timestamp
+		{ID: "a", Timestamp: at(5)},
+		{ID: "y"},
+		// The same instant in another zone ties with "b".
+		{ID: "a0", Timestamp: at(1).In(time.FixedZone("X", 3600))},
+	}
+	sortTurns(turns)
+	var got []string
+	for _, tr := range turns {
+		got = append(got, tr.ID)
+	}
+	if fmt.Sprint(got) != "[y z a0 b a c]" {
+		t.Fatalf("order = %v, want [y z a0 b a c]", got)
+	}
+
+	for _, tc := range []struct {
+		in   interface{}
+		want time.Time
+	}{
+		{"2025-06-30T12:05:00Z", at(5)},
+		{"2025-06-30T12:05:00.000000001Z", at(5).Add(1)},
+		{"30/06/2025", time.Time{}},
+		{1751285100.0, time.Time{}},
+		{nil, time.Time{}},
+	} {
+		if got := parseTurnTimestamp(tc.in); !got.Equal(tc.want) {
+			t.Fatalf("parseTurnTimestamp(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
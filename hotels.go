@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HotelQuery selects hotels in a city. CheckIn/CheckOut are optional but come
+// together; without them only nightly prices are returned. Zero values for
+// the filters disable them.
+type HotelQuery struct {
+	City          string
+	CheckIn       time.Time
+	CheckOut      time.Time
+	Guests        int
+	MaxNightlyUSD float64
+	MinStars      int
+	Amenities     []string
+}
+
+// Nights is the length of the stay, or 0 without dates.
+func (q HotelQuery) Nights() int {
+	if q.CheckIn.IsZero() || q.CheckOut.IsZero() {
+		return 0
+	}
+	return int(q.CheckOut.Sub(q.CheckIn).Hours() / 24)
+}
+
+// HotelOption is one hotel matching a query, priced for the requested stay.
+type HotelOption struct {
+	Name       string   `json:"name"`
+	City       string   `json:"city"`
+	Area       string   `json:"area,omitempty"`
+	Stars      int      `json:"stars"`
+	Amenities  []string `json:"amenities"`
+	NightlyUSD float64  `json:"nightly_usd"`
+	Rooms      int      `json:"rooms"`
+	Nights     int      `json:"nights,omitempty"`
+	TotalUSD   float64  `json:"total_usd,omitempty"`
+}
+
+// HotelProvider looks up hotels. The file-backed catalog serves offline
+// runs; a booking API can implement the same interface.
+type HotelProvider interface {
+	SearchHotels(ctx context.Context, q HotelQuery) ([]HotelOption, error)
+}
+
+// hotelProvider is the provider behind get_hotel_schedule, set up in
+// initRuntime.
+var hotelProvider HotelProvider
+
+// catalogHotel is one entry of the hotel catalog. Unavailable lists date
+// ranges (check-in inclusive, check-out exclusive) with no rooms left.
+type catalogHotel struct {
+	Name         string      `json:"name"`
+	City         string      `json:"city"`
+	Area         string      `json:"area"`
+	Stars        int         `json:"stars"`
+	Amenities    []string    `json:"amenities"`
+	NightlyUSD   float64     `json:"nightly_usd"`
+	MaxGuests    int         `json:"max_guests"` // per room
+	Unavailable  []dateRange `json:"unavailable"`
+	amenitiesSet map[string]bool
+}
+
+type dateRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	from, to time.Time
+}
+
+// fileHotelProvider serves a hotel catalog loaded from a JSON file.
+type fileHotelProvider struct {
+	hotels []catalogHotel
+}
+
+// newFileHotelProvider loads a JSON array of hotels from path.
+func newFileHotelProvider(path string) (*fileHotelProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hotels []catalogHotel
+	if err := json.Unmarshal(data, &hotels); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	for i := range hotels {
+		if err := hotels[i].prepare(); err != nil {
+			return nil, fmt.Errorf("%s: hotel %d (%s): %w", path, i+1, hotels[i].Name, err)
+		}
+	}
+	return &fileHotelProvider{hotels: hotels}, nil
+}
+
+func (h *catalogHotel) prepare() error {
+	if h.MaxGuests <= 0 {
+		h.MaxGuests = 2
+	}
+	h.amenitiesSet = map[string]bool{}
+	for _, a := range h.Amenities {
+		h.amenitiesSet[normalizeAmenity(a)] = true
+	}
+	for i := range h.Unavailable {
+		r := &h.Unavailable[i]
+		var err error
+		if r.from, err = time.Parse(dateLayout, r.From); err != nil {
+			return fmt.Errorf("invalid unavailable.from %q", r.From)
+		}
+		if r.to, err = time.Parse(dateLayout, r.To); err != nil {
+			return fmt.Errorf("invalid unavailable.to %q", r.To)
+		}
+	}
+	return nil
+}
+
+// availableFor reports whether the hotel has rooms for every night between
+// checkIn and checkOut. An unavailable range blocks the nights from its from
+// date up to, but not including, its to date, so a stay may check out on
+// from or check in on to.
+func (h *catalogHotel) availableFor(checkIn, checkOut time.Time) bool {
+	if checkIn.IsZero() {
+		return true
+	}
+	for _, r := range h.Unavailable {
+		if checkIn.Before(r.to) && r.from.Before(checkOut) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeAmenity(s string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), " ", "_")
+}
+
+func (p *fileHotelProvider) SearchHotels(ctx context.Context, q HotelQuery) ([]HotelOption, error) {
+	guests := q.Guests
+	if guests <= 0 {
+		guests = 1
+	}
+	nights := q.Nights()
+
+	var out []HotelOption
+	for i := range p.hotels {
+		h := &p.hotels[i]
+		if !strings.EqualFold(h.City, strings.TrimSpace(q.City)) {
+			continue
+		}
+		if q.MaxNightlyUSD > 0 && h.NightlyUSD > q.MaxNightlyUSD {
+			continue
+		}
+		if h.Stars < q.MinStars || !h.hasAmenities(q.Amenities) {
+			continue
+		}
+		if !h.availableFor(q.CheckIn, q.CheckOut) {
+			continue
+		}
+
+		rooms := (guests + h.MaxGuests - 1) / h.MaxGuests
+		opt := HotelOption{
+			Name:       h.Name,
+			City:       h.City,
+			Area:       h.Area,
+			Stars:      h.Stars,
+			Amenities:  h.Amenities,
+			NightlyUSD: h.NightlyUSD,
+			Rooms:      rooms,
+			Nights:     nights,
+		}
+		if nights > 0 {
+			opt.TotalUSD = h.NightlyUSD * float64(nights*rooms)
+		}
+		out = append(out, opt)
+	}
+
+	// Cheapest per night for the whole party first, better hotels first on
+	// a tie.
+	perNight := func(o HotelOption) float64 { return o.NightlyUSD * float64(o.Rooms) }
+	sort.SliceStable(out, func(i, j int) bool {
+		if perNight(out[i]) != perNight(out[j]) {
+			return perNight(out[i]) < perNight(out[j])
+		}
+		return out[i].Stars > out[j].Stars
+	})
+	return out, nil
+}
+
+func (h *catalogHotel) hasAmenities(want []string) bool {
+	for _, a := range want {
+		if !h.amenitiesSet[normalizeAmenity(a)] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseStay parses optional check-in/check-out dates, which must be given
+// together with check-out after check-in.
+func parseStay(checkIn, checkOut string) (time.Time, time.Time, error) {
+	in, err := parseDate(checkIn)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	out, err := parseDate(checkOut)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if in.IsZero() != out.IsZero() {
+		return time.Time{}, time.Time{}, errors.New("check_in and check_out must be given together")
+	}
+	if !in.IsZero() && !out.After(in) {
+		return time.Time{}, time.Time{}, errors.New("check_out must be after check_in")
+	}
+	return in, out, nil
+}
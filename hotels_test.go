@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testHotelProvider(t *testing.T) *fileHotelProvider {
+	hotels := []catalogHotel{
+		{Name: "Twin", City: "Nairobi", Stars: 3, NightlyUSD: 100, MaxGuests: 2,
+			Unavailable: []dateRange{{From: "2025-12-20", To: "2025-12-23"}}},
+		{Name: "Family", City: "Nairobi", Stars: 4, NightlyUSD: 180, MaxGuests: 4, Amenities: []string{"Airport Shuttle"}},
+		{Name: "Single", City: "Nairobi", Stars: 2, NightlyUSD: 60},
+		{Name: "Elsewhere", City: "Lagos", Stars: 5, NightlyUSD: 50},
+	}
+	for i := range hotels {
+		if err := hotels[i].prepare(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &fileHotelProvider{hotels: hotels}
+}
+
+func TestSearchHotelsRoomsAndTotals(t *testing.T) {
+	p := testHotelProvider(t)
+	day := func(d int) time.Time { return time.Date(2025, 11, d, 0, 0, 0, 0, time.UTC) }
+	cases := []struct {
+		name string
+		q    HotelQuery
+		want []string // "name rooms nights total" per result
+	}{
+		{
+			// Single defaults to two guests per room.
+			name: "no dates",
+			q:    HotelQuery{City: "nairobi"},
+			want: []string{"Single 1 0 0", "Twin 1 0 0", "Family 1 0 0"},
+		},
+		{
+			name: "rooms per max_guests",
+			q:    HotelQuery{City: "Nairobi", Guests: 5, CheckIn: day(1), CheckOut: day(4)},
+			want: []string{"Single 3 3 540", "Twin 3 3 900", "Family 2 3 1080"},
+		},
+		{
+			name: "full rooms",
+			q:    HotelQuery{City: "Nairobi", Guests: 4, CheckIn: day(1), CheckOut: day(3)},
+			want: []string{"Single 2 2 240", "Family 1 2 360", "Twin 2 2 400"},
+		},
+		{
+			name: "filters",
+			q:    HotelQuery{City: "Nairobi", MaxNightlyUSD: 180, MinStars: 3, Amenities: []string{"airport_shuttle"}},
+			want: []string{"Family 1 0 0"},
+		},
+	}
+	for _, tc := range cases {
+		opts, err := p.SearchHotels(context.Background(), tc.q)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var got []string
+		for _, o := range opts {
+			got = append(got, fmt.Sprintf("%s %d %d %g", o.Name, o.Rooms, o.Nights, o.TotalUSD))
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tc.want) {
+			t.Fatalf("%s:\ngot  %q\nwant %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHotelAvailableFor(t *testing.T) {
+	// Twin is booked out for the nights of Dec 20, 21 and 22.
+	h := testHotelProvider(t).hotels[0]
+	day := func(d int) time.Time { return time.Date(2025, 12, d, 0, 0, 0, 0, time.UTC) }
+	cases := []struct {
+		in, out int
+		want    bool
+	}{
+		{17, 20, true},  // checks out on from
+		{23, 26, true},  // checks in on to
+		{18, 21, false}, // stays the night of from
+		{22, 24, false}, // stays the night before to
+		{21, 22, false},
+		{15, 28, false},
+	}
+	for _, tc := range cases {
+		if got := h.availableFor(day(tc.in), day(tc.out)); got != tc.want {
+			t.Fatalf("availableFor(Dec %d, Dec %d) = %v, want %v", tc.in, tc.out, got, tc.want)
+		}
+	}
+	if !h.availableFor(time.Time{}, time.Time{}) {
+		t.Fatalf("availableFor without dates = false, want true")
+	}
+}
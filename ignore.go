@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ingestion skips files by path (a gitignore-style .ragignore at the top of
+// each ingested directory plus RAG_INCLUDE / RAG_EXCLUDE), by size, by content
+// (binary files) and symlinks unless RAG_FOLLOW_SYMLINKS is set. Every skipped
+// file is listed with its reason at the end of the run.
+
+// ragIgnoreFile is read from the top of every ingested directory.
+const ragIgnoreFile = ".ragignore"
+
+// defaultIgnorePatterns come before .ragignore and RAG_EXCLUDE, which can
+// re-include any of them with "!".
+var defaultIgnorePatterns = []string{
+	".git/", ".hg/", ".svn/", ragIgnoreFile,
+	".DS_Store", "Thumbs.db",
+	"*.lock", "package-lock.json", "pnpm-lock.yaml", "go.sum",
+}
+
+// binarySniffLen is how much of a file is checked for NUL bytes, the same
+// heuristic git uses.
+const binarySniffLen = 8000
+
+// SkippedFile is a file or directory ingestion left out, and why.
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ignoreRule is one compiled .ragignore line.
+type ignoreRule struct {
+	origin  string // where the rule came from, for the skip report
+	pattern string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// parseIgnoreRule compiles one gitignore-style line. Blank lines and
+// comments yield ok == false.
+//
+// As in gitignore, "!" negates, a trailing "/" matches directories only, a
+// pattern with a slash other than a trailing one is relative to the ingested
+// directory while one without matches at any depth, "*" and "?" do not cross
+// "/", and "**" does.
+func parseIgnoreRule(origin, line string) (rule ignoreRule, ok bool, err error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false, nil
+	}
+	rule = ignoreRule{origin: origin, pattern: line}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false, nil
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	p := []rune(line)
+	for i := 0; i < len(p); i++ {
+		rest := string(p[i:])
+		switch {
+		case strings.HasPrefix(rest, "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case rest == "/**":
+			re.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(rest, "**"):
+			re.WriteString(".*")
+			i++
+		case p[i] == '*':
+			re.WriteString("[^/]*")
+		case p[i] == '?':
+			re.WriteString("[^/]")
+		case p[i] == '\\' && i+1 < len(p):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(p[i])))
+		case p[i] == '[':
+			end := -1
+			for j := i + 1; j < len(p); j++ {
+				if p[j] == ']' {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := string(p[i+1 : end])
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(p[i])))
+		}
+	}
+	re.WriteString("$")
+
+	rule.re, err = regexp.Compile(re.String())
+	if err != nil {
+		return ignoreRule{}, false, fmt.Errorf("%s: invalid pattern %q: %w", origin, rule.pattern, err)
+	}
+	return rule, true, nil
+}
+
+// ignoreRules is an ordered rule list; the last rule that matches wins.
+type ignoreRules []ignoreRule
+
+// match reports whether rel (slash-separated, relative to the ingested
+// directory) is ignored, and by which rule.
+func (rs ignoreRules) match(rel string, isDir bool) (bool, *ignoreRule) {
+	var hit *ignoreRule
+	for i := range rs {
+		r := &rs[i]
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			hit = r
+		}
+	}
+	return hit != nil && !hit.negate, hit
+}
+
+func (rs *ignoreRules) add(origin string, lines ...string) error {
+	for _, l := range lines {
+		rule, ok, err := parseIgnoreRule(origin, l)
+		if err != nil {
+			return err
+		}
+		if ok {
+			*rs = append(*rs, rule)
+		}
+	}
+	return nil
+}
+
+// addFile adds the rules of an ignore file, if it exists.
+func (rs *ignoreRules) addFile(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	defer file.Close()
+
+	sc := bufio.NewScanner(file)
+	for n := 1; sc.Scan(); n++ {
+		if err := rs.add(fmt.Sprintf("%s:%d", path, n), sc.Text()); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// splitPatterns splits a comma-separated config value into patterns.
+func splitPatterns(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ingestFilter decides which files under one ingested root are indexed.
+type ingestFilter struct {
+	root    string
+	exclude ignoreRules
+	include ignoreRules
+	maxSize int64
+	follow  bool
+}
+
+// newIngestFilter builds the filter for root from the default patterns,
+// root/.ragignore and the RAG_* settings. A root that is a single file has
+// no .ragignore and is never skipped by pattern.
+func newIngestFilter(root string) (*ingestFilter, error) {
+	f := &ingestFilter{
+		root:    root,
+		maxSize: currentConfig.MaxFileSize,
+		follow:  currentConfig.FollowSymlinks,
+	}
+	if err := f.exclude.add("default", defaultIgnorePatterns...); err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(root); err == nil && info.IsDir() {
+		if err := f.exclude.addFile(filepath.Join(root, ragIgnoreFile)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := f.exclude.add("RAG_EXCLUDE", splitPatterns(currentConfig.IngestExclude)...); err != nil {
+		return nil, err
+	}
+	if err := f.include.add("RAG_INCLUDE", splitPatterns(currentConfig.IngestInclude)...); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// skipPath returns why path is left out by the include and exclude
+// patterns, or "" if it is not. Include patterns only apply to files.
+func (f *ingestFilter) skipPath(path string, isDir bool) string {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil || rel == "." {
+		return ""
+	}
+	rel = filepath.ToSlash(rel)
+	if ignored, rule := f.exclude.match(rel, isDir); ignored {
+		return fmt.Sprintf("ignored by %q (%s)", rule.pattern, rule.origin)
+	}
+	if !isDir && len(f.include) > 0 {
+		if included, _ := f.include.match(rel, false); !included {
+			return "not matched by RAG_INCLUDE"
+		}
+	}
+	return ""
+}
+
+// skipSize returns why a file of size bytes is too large, or "".
+func (f *ingestFilter) skipSize(size int64) string {
+	if f.maxSize > 0 && size > f.maxSize {
+		return fmt.Sprintf("too large (%s, limit %s)", formatByteSize(size), formatByteSize(f.maxSize))
+	}
+	return ""
+}
+
+// looksBinary reports whether data has a NUL byte near its start. PDF and
+// DOCX files are binary but have loaders of their own, so they never count.
+func looksBinary(path string, data []byte) bool {
+	switch loaderFor(path, data).(type) {
+	case pdfLoader, docxLoader:
+		return false
+	}
+	return bytes.IndexByte(data[:min(len(data), binarySniffLen)], 0) >= 0
+}
+
+// parseByteSize parses a size such as "10MB", "512K" or "1048576". Units are
+// binary multiples.
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"G", 1 << 30}, {"MB", 1 << 20}, {"M", 1 << 20}, {"KB", 1 << 10}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+func formatByteSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
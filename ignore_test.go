@@ -0,0 +1,152 @@
+package main
+
+import "testing"
+
+func TestParseIgnoreRule(t *testing.T) {
+	cases := []struct {
+		line    string
+		ok      bool
+		negate  bool
+		dirOnly bool
+		match   []string
+		noMatch []string
+	}{
+		{line: ""},
+		{line: "   "},
+		{line: "# comment"},
+		{line: "/"},
+		{line: "*.log", ok: true, match: []string{"a.log", "x/y/a.log"}, noMatch: []string{"a.log.txt", "alog"}},
+		// No slash: matches at any depth. A slash anchors to the root.
+		{line: "build", ok: true, match: []string{"build", "src/build"}, noMatch: []string{"builds"}},
+		{line: "/build", ok: true, match: []string{"build"}, noMatch: []string{"src/build"}},
+		{line: "docs/*.md", ok: true, match: []string{"docs/a.md"}, noMatch: []string{"docs/x/a.md", "src/docs/a.md"}},
+		{line: "tmp/", ok: true, dirOnly: true, match: []string{"tmp", "a/tmp"}},
+		{line: "!keep.log", ok: true, negate: true, match: []string{"keep.log", "a/keep.log"}},
+		{line: `\!bang`, ok: true, match: []string{"!bang"}},
+		{line: `\#hash`, ok: true, match: []string{"#hash"}},
+		// "*" and "?" stop at "/"; "**" crosses it.
+		{line: "a?c", ok: true, match: []string{"abc"}, noMatch: []string{"a/c", "ac"}},
+		{line: "**/logs", ok: true, match: []string{"logs", "a/b/logs"}},
+		{line: "vendor/**", ok: true, match: []string{"vendor/a", "vendor/a/b"}, noMatch: []string{"vendor"}},
+		{line: "a/**/b", ok: true, match: []string{"a/b", "a/x/b", "a/x/y/b"}, noMatch: []string{"ab", "x/a/b"}},
+		{line: "*.[ch]", ok: true, match: []string{"x.c", "x.h"}, noMatch: []string{"x.o", "x.ch"}},
+		{line: "file[!0-9]", ok: true, match: []string{"filex"}, noMatch: []string{"file1"}},
+		{line: "[abc", ok: true, match: []string{"[abc"}},
+		{line: "a.b  ", ok: true, match: []string{"a.b"}, noMatch: []string{"axb"}},
+	}
+	for _, tc := range cases {
+		rule, ok, err := parseIgnoreRule("test", tc.line)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.line, err)
+		}
+		if ok != tc.ok {
+			t.Fatalf("%q: ok = %v, want %v", tc.line, ok, tc.ok)
+		}
+		if !ok {
+			continue
+		}
+		if rule.negate != tc.negate || rule.dirOnly != tc.dirOnly {
+			t.Fatalf("%q: negate, dirOnly = %v, %v, want %v, %v", tc.line, rule.negate, rule.dirOnly, tc.negate, tc.dirOnly)
+		}
+		for _, p := range tc.match {
+			if !rule.re.MatchString(p) {
+				t.Fatalf("%q (%s) should match %q", tc.line, rule.re, p)
+			}
+		}
+		for _, p := range tc.noMatch {
+			if rule.re.MatchString(p) {
+				t.Fatalf("%q (%s) should not match %q", tc.line, rule.re, p)
+			}
+		}
+	}
+}
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	var rs ignoreRules
+	if err := rs.add("test", "*.log", "!keep.log", "logs/", "!logs/", "cache/", "secret*", "!secret.md", "secret.md"); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+		rule    string // pattern of the deciding rule, "" for none
+	}{
+		{"a.txt", false, false, ""},
+		{"a.log", false, true, "*.log"},
+		{"x/keep.log", false, false, "!keep.log"},
+		// The last matching rule wins, even over an earlier negation.
+		{"logs", true, false, "!logs/"},
+		{"secret.md", false, true, "secret.md"},
+		{"secret.txt", false, true, "secret*"},
+		// Directory-only rules skip files of the same name.
+		{"cache", true, true, "cache/"},
+		{"cache", false, false, ""},
+	}
+	for _, tc := range cases {
+		ignored, rule := rs.match(tc.rel, tc.isDir)
+		pattern := ""
+		if rule != nil {
+			pattern = rule.pattern
+		}
+		if ignored != tc.ignored || pattern != tc.rule {
+			t.Fatalf("match(%q, %v) = %v by %q, want %v by %q", tc.rel, tc.isDir, ignored, pattern, tc.ignored, tc.rule)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"1048576", 1 << 20, true},
+		{"0", 0, true},
+		{"512K", 512 << 10, true},
+		{"512kb", 512 << 10, true},
+		{" 10 MB ", 10 << 20, true},
+		{"10M", 10 << 20, true},
+		{"2GB", 2 << 30, true},
+		{"100B", 100, true},
+		{"", 0, false},
+		{"MB", 0, false},
+		{"1.5MB", 0, false},
+		{"-1", 0, false},
+		{"10TB", 0, false},
+	}
+	for _, tc := range cases {
+		got, err := parseByteSize(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Fatalf("parseByteSize(%q) = %d, %v; want %d, ok %v", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestLooksBinary(t *testing.T) {
+	nulLate := make([]byte, binarySniffLen+10)
+	for i := range nulLate {
+		nulLate[i] = 'a'
+	}
+	nulLate[binarySniffLen+5] = 0
+
+	cases := []struct {
+		path string
+		data []byte
+		want bool
+	}{
+		{"a.txt", []byte("plain text\n"), false},
+		{"a.txt", []byte{}, false},
+		{"a.bin", []byte("ELF\x00\x01\x02"), true},
+		{"a.txt", []byte("looks like text\x00"), true},
+		{"a.txt", nulLate, false},
+		// PDF and DOCX have loaders of their own.
+		{"a.pdf", []byte("%PDF-1.7\x00\x01"), false},
+		{"a.docx", []byte("PK\x03\x04\x00\x00"), false},
+	}
+	for _, tc := range cases {
+		if got := looksBinary(tc.path, tc.data); got != tc.want {
+			t.Fatalf("looksBinary(%q, %q...) = %v, want %v", tc.path, tc.data[:min(len(tc.data), 16)], got, tc.want)
+		}
+	}
+}
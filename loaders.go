@@ -0,0 +1,915 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Document is the text a DocumentLoader extracted from one file. Files with
+// natural parts (PDF pages, JSON records) get one section per part, so no
+// chunk straddles two parts and each chunk carries its part's metadata.
+type Document struct {
+	Title    string
+	Format   string
+	Sections []DocumentSection
+}
+
+// DocumentSection is one part of a Document. Meta holds per-part metadata
+// such as the page number and is stored on every chunk cut from the section.
+// Heading, if set, starts every chunk of the section, so a chunk from the
+// middle of a long section still says what it is about.
+type DocumentSection struct {
+	Heading string
+	Text    string
+	Meta    map[string]interface{}
+	// Symbols are the names the section declares, stored as "symbol".
+	Symbols []string
+	// Merge marks a section that may share a chunk with the Merge sections
+	// next to it, such as one of a run of short declarations.
+	Merge bool
+}
+
+// DocumentLoader turns the raw bytes of a file into text.
+type DocumentLoader interface {
+	Load(path string, data []byte) (*Document, error)
+}
+
+// errUnsupportedFormat is returned for files no loader can read, e.g.
+// images or archives.
+var errUnsupportedFormat = errors.New("unsupported file format")
+
+var loadersByExt = map[string]DocumentLoader{
+	".txt":      textLoader{},
+	".md":       markdownLoader{},
+	".markdown": markdownLoader{},
+	".html":     htmlLoader{},
+	".htm":      htmlLoader{},
+	".xhtml":    htmlLoader{},
+	".pdf":      pdfLoader{},
+	".docx":     docxLoader{},
+	".csv":      csvLoader{comma: ','},
+	".tsv":      csvLoader{comma: '\t'},
+	".json":     jsonLoader{},
+	".jsonl":    jsonLoader{lines: true},
+	".ndjson":   jsonLoader{lines: true},
+
+	".go":    codeLoader{lang: "go"},
+	".py":    codeLoader{lang: "python"},
+	".rb":    codeLoader{lang: "ruby"},
+	".js":    codeLoader{lang: "javascript"},
+	".mjs":   codeLoader{lang: "javascript"},
+	".cjs":   codeLoader{lang: "javascript"},
+	".jsx":   codeLoader{lang: "javascript"},
+	".ts":    codeLoader{lang: "typescript"},
+	".tsx":   codeLoader{lang: "typescript"},
+	".java":  codeLoader{lang: "java"},
+	".kt":    codeLoader{lang: "kotlin"},
+	".scala": codeLoader{lang: "scala"},
+	".rs":    codeLoader{lang: "rust"},
+	".c":     codeLoader{lang: "c"},
+	".h":     codeLoader{lang: "c"},
+	".cc":    codeLoader{lang: "cpp"},
+	".cpp":   codeLoader{lang: "cpp"},
+	".hpp":   codeLoader{lang: "cpp"},
+	".cs":    codeLoader{lang: "csharp"},
+	".php":   codeLoader{lang: "php"},
+	".swift": codeLoader{lang: "swift"},
+	".lua":   codeLoader{lang: "lua"},
+	".sh":    codeLoader{lang: "shell"},
+	".bash":  codeLoader{lang: "shell"},
+	".sql":   codeLoader{lang: "sql"},
+	".proto": codeLoader{lang: "protobuf"},
+	".tf":    codeLoader{lang: "terraform"},
+	".yaml":  codeLoader{lang: "yaml"},
+	".yml":   codeLoader{lang: "yaml"},
+	".toml":  codeLoader{lang: "toml"},
+}
+
+// loaderFor picks a loader by file extension, falling back to sniffing the
+// content for files with an unknown or missing extension. Anything that
+// sniffs as valid UTF-8 text (source code, YAML, logs...) is loaded as plain
+// text; it returns nil for everything else.
+func loaderFor(path string, data []byte) DocumentLoader {
+	if l, ok := loadersByExt[strings.ToLower(filepath.Ext(path))]; ok {
+		return l
+	}
+	switch ct := http.DetectContentType(data); {
+	case strings.HasPrefix(ct, "application/pdf"):
+		return pdfLoader{}
+	case strings.HasPrefix(ct, "text/html"):
+		return htmlLoader{}
+	case strings.HasPrefix(ct, "application/zip") && isDocx(data):
+		return docxLoader{}
+	case strings.HasPrefix(ct, "text/") && utf8.Valid(data):
+		return textLoader{}
+	}
+	return nil
+}
+
+// loadDocument extracts the text of a file with the loader for its format.
+func loadDocument(path string, data []byte) (doc *Document, err error) {
+	l := loaderFor(path, data)
+	if l == nil {
+		return nil, errUnsupportedFormat
+	}
+	// The PDF reader panics on some malformed files; treat that like any
+	// other load error instead of taking down the ingestion.
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("loading %s: %v", path, r)
+		}
+	}()
+	return l.Load(path, data)
+}
+
+// TextChunk is one chunk of a document to index, with the metadata stored
+// alongside it.
+type TextChunk struct {
+	Text string
+	Meta map[string]interface{}
+}
+
+// chunkDocument chunks each section of doc on its own, after merging runs
+// of Merge sections that fit in one chunk together. Every chunk carries the
+// document's title and format plus its section's metadata and symbols, and
+// the indexes of the section's first and last chunk as "section_start" and
+// "section_end", so retrieval can expand a hit to its whole section.
+func chunkDocument(doc *Document, chunker Chunker) []TextChunk {
+	var chunks []TextChunk
+	for _, s := range mergeSections(doc.Sections, chunker) {
+		texts := chunker.Chunk(s.Heading, s.Text)
+		start, end := len(chunks), len(chunks)+len(texts)-1
+		for _, text := range texts {
+			meta := map[string]interface{}{"section_start": start, "section_end": end}
+			if doc.Title != "" {
+				meta["title"] = doc.Title
+			}
+			if doc.Format != "" {
+				meta["format"] = doc.Format
+			}
+			for k, v := range s.Meta {
+				meta[k] = v
+			}
+			if len(s.Symbols) > 0 {
+				meta["symbol"] = symbolList(s.Symbols)
+			}
+			chunks = append(chunks, TextChunk{Text: text, Meta: meta})
+		}
+	}
+	return chunks
+}
+
+// mergeSections joins each Merge section to the one before it while both
+// are Merge sections under the same heading and the result is still a
+// single chunk. A merged section keeps the metadata of its first part and
+// the symbols of all of them, which are then exactly those in its chunk.
+func mergeSections(sections []DocumentSection, chunker Chunker) []DocumentSection {
+	var out []DocumentSection
+	for _, s := range sections {
+		if n := len(out); n > 0 && s.Merge && out[n-1].Merge && out[n-1].Heading == s.Heading {
+			prev := &out[n-1]
+			text := prev.Text + "\n" + s.Text
+			if len(chunker.Chunk(s.Heading, text)) == 1 {
+				prev.Text = text
+				prev.Symbols = append(prev.Symbols[:len(prev.Symbols):len(prev.Symbols)], s.Symbols...)
+				continue
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// textDocument wraps plain text in a single-section Document.
+func textDocument(format, text string) *Document {
+	return &Document{Format: format, Sections: []DocumentSection{{Text: text}}}
+}
+
+// ------------------
+// Plain text
+// ------------------
+
+type textLoader struct{}
+
+func (textLoader) Load(_ string, data []byte) (*Document, error) {
+	return textDocument("text", strings.ToValidUTF8(string(data), "�")), nil
+}
+
+// ------------------
+// Markdown
+// ------------------
+
+type markdownLoader struct{}
+
+var (
+	mdHeading     = regexp.MustCompile(`^ {0,3}#{1,6}(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	mdFence       = regexp.MustCompile("^ {0,3}(```|~~~)")
+	mdRule        = regexp.MustCompile(`^ {0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,}|=+\s*)$`)
+	mdListMarker  = regexp.MustCompile(`^(\s*)(?:[-*+]|\d+[.)])\s+(?:\[[ xX]\]\s+)?`)
+	mdQuote       = regexp.MustCompile(`^\s*(?:>\s?)+`)
+	mdTableRule   = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+	mdLinkDef     = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s+\S+`)
+	mdComment     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	mdImage       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink        = regexp.MustCompile(`\[([^\]]+)\](?:\([^)]*\)|\[[^\]]*\])`)
+	mdAutolink    = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	mdInlineCode  = regexp.MustCompile("`+([^`]+?)`+")
+	mdStrong      = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|\b__(\S(?:.*?\S)?)__\b`)
+	mdEmphasis    = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*|\b_(\S(?:[^_]*?\S)?)_\b`)
+	mdStrike      = regexp.MustCompile(`~~(.+?)~~`)
+	mdHTMLTag     = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	mdFrontTitle  = regexp.MustCompile(`^title:\s*(.*?)\s*$`)
+	mdTableBorder = regexp.MustCompile(`^\s*\||\|\s*$`)
+)
+
+// headingSep joins the headings of a heading path.
+const headingSep = " > "
+
+// Load strips Markdown syntax and splits the text at every heading. Each
+// section's Heading and "heading_path" metadata is the path of headings it
+// sits under, e.g. "Policy > Travel > Per diem"; text before the first
+// heading has none. The title comes from YAML front matter or the first
+// level-one heading.
+func (markdownLoader) Load(_ string, data []byte) (*Document, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = mdComment.ReplaceAllString(text, "")
+	lines := strings.Split(text, "\n")
+
+	doc := &Document{Format: "markdown"}
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if t := strings.TrimSpace(lines[i]); t == "---" || t == "..." {
+				lines = lines[i+1:]
+				break
+			}
+			if m := mdFrontTitle.FindStringSubmatch(lines[i]); m != nil {
+				doc.Title = strings.Trim(m[1], `"'`)
+			}
+		}
+	}
+
+	var (
+		out     []string
+		path    [6]string // the current heading at each level
+		inFence string
+	)
+	flush := func() {
+		text := strings.Trim(strings.Join(out, "\n"), "\n")
+		out = out[:0]
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		s := DocumentSection{Text: text}
+		if hp := headingPath(path[:]); hp != "" {
+			s.Heading = hp
+			s.Meta = map[string]interface{}{"heading_path": hp}
+		}
+		doc.Sections = append(doc.Sections, s)
+	}
+	for _, line := range lines {
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			switch {
+			case inFence == "":
+				inFence = m[1]
+				continue
+			case inFence == m[1]:
+				inFence = ""
+				continue
+			}
+		}
+		if inFence != "" {
+			out = append(out, line)
+			continue
+		}
+
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			heading := stripMarkdownInline(m[1])
+			if doc.Title == "" && strings.HasPrefix(strings.TrimSpace(line), "# ") {
+				doc.Title = heading
+			}
+			flush()
+			marks := strings.TrimLeft(line, " ")
+			level := len(marks) - len(strings.TrimLeft(marks, "#"))
+			path[level-1] = heading
+			for i := level; i < len(path); i++ {
+				path[i] = ""
+			}
+			continue
+		}
+		if mdRule.MatchString(line) || mdTableRule.MatchString(line) || mdLinkDef.MatchString(line) {
+			continue
+		}
+
+		line = mdQuote.ReplaceAllString(line, "")
+		line = mdListMarker.ReplaceAllString(line, "$1")
+		if strings.Contains(line, "|") && mdTableBorder.MatchString(line) {
+			cells := strings.Split(strings.Trim(strings.TrimSpace(line), "|"), "|")
+			for i := range cells {
+				cells[i] = strings.TrimSpace(cells[i])
+			}
+			line = strings.Join(cells, " | ")
+		}
+		out = append(out, stripMarkdownInline(line))
+	}
+
+	flush()
+	return doc, nil
+}
+
+// headingPath joins the non-empty headings of path, outermost first.
+func headingPath(path []string) string {
+	var parts []string
+	for _, h := range path {
+		if h = strings.TrimSpace(h); h != "" {
+			parts = append(parts, h)
+		}
+	}
+	return strings.Join(parts, headingSep)
+}
+
+// stripMarkdownInline replaces links and images with their text and drops
+// emphasis, code spans and inline HTML.
+func stripMarkdownInline(s string) string {
+	s = mdImage.ReplaceAllString(s, "$1")
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdAutolink.ReplaceAllString(s, "$1")
+	s = mdInlineCode.ReplaceAllString(s, "$1")
+	s = mdStrong.ReplaceAllString(s, "$1$2")
+	s = mdEmphasis.ReplaceAllString(s, "$1$2")
+	s = mdStrike.ReplaceAllString(s, "$1")
+	s = mdHTMLTag.ReplaceAllString(s, "")
+	return strings.TrimRight(s, " \t")
+}
+
+// ------------------
+// HTML
+// ------------------
+
+type htmlLoader struct{}
+
+// htmlSkip are elements whose content is never part of the readable text.
+var htmlSkip = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Svg: true, atom.Iframe: true, atom.Nav: true,
+	atom.Footer: true, atom.Aside: true, atom.Form: true, atom.Button: true,
+	atom.Select: true,
+}
+
+// htmlBlock are elements that start a new paragraph; htmlLine start a new
+// line within one.
+var (
+	htmlBlock = map[atom.Atom]bool{
+		atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+		atom.Main: true, atom.Header: true, atom.H1: true, atom.H2: true,
+		atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+		atom.Ul: true, atom.Ol: true, atom.Dl: true, atom.Table: true,
+		atom.Blockquote: true, atom.Pre: true, atom.Figure: true, atom.Hr: true,
+	}
+	htmlLine = map[atom.Atom]bool{
+		atom.Br: true, atom.Li: true, atom.Tr: true, atom.Dt: true, atom.Dd: true,
+		atom.Caption: true, atom.Figcaption: true,
+	}
+)
+
+var (
+	htmlSpaces     = regexp.MustCompile(`[ \t\f\r\n]+`)
+	htmlBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// Load extracts the readable text of a page: the first <main> or <article>
+// if there is one, the whole <body> otherwise, without scripts, styles and
+// navigation. The title comes from <title>, or the first <h1>.
+func (htmlLoader) Load(_ string, data []byte) (*Document, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing HTML: %w", err)
+	}
+
+	doc := &Document{Format: "html"}
+	var title, h1, body, content *html.Node
+	var find func(n *html.Node)
+	find = func(n *html.Node) {
+		var first **html.Node
+		switch n.DataAtom {
+		case atom.Title:
+			first = &title
+		case atom.H1:
+			first = &h1
+		case atom.Body:
+			first = &body
+		case atom.Main, atom.Article:
+			first = &content
+		}
+		if first != nil && *first == nil {
+			*first = n
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(root)
+
+	if title != nil {
+		doc.Title = strings.TrimSpace(htmlSpaces.ReplaceAllString(htmlNodeText(title), " "))
+	}
+	if doc.Title == "" && h1 != nil {
+		doc.Title = strings.TrimSpace(htmlSpaces.ReplaceAllString(htmlNodeText(h1), " "))
+	}
+	if content == nil {
+		content = body
+	}
+	if content == nil {
+		content = root
+	}
+
+	var b strings.Builder
+	var walk func(n *html.Node, pre bool)
+	walk = func(n *html.Node, pre bool) {
+		switch n.Type {
+		case html.TextNode:
+			if pre {
+				b.WriteString(n.Data)
+			} else {
+				b.WriteString(htmlSpaces.ReplaceAllString(n.Data, " "))
+			}
+			return
+		case html.ElementNode:
+			if htmlSkip[n.DataAtom] {
+				return
+			}
+			if n.DataAtom == atom.Img {
+				if alt := htmlAttr(n, "alt"); alt != "" {
+					b.WriteString(" " + alt + " ")
+				}
+				return
+			}
+		}
+		// Blocks are set off on both sides; lines and cells only start
+		// with a separator, so a list or a row does not gain blank lines.
+		sep := ""
+		switch {
+		case htmlBlock[n.DataAtom]:
+			sep = "\n\n"
+		case htmlLine[n.DataAtom]:
+			b.WriteString("\n")
+		case n.DataAtom == atom.Td || n.DataAtom == atom.Th:
+			b.WriteString(" | ")
+		}
+		b.WriteString(sep)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, pre || n.DataAtom == atom.Pre)
+		}
+		b.WriteString(sep)
+	}
+	walk(content, false)
+
+	lines := strings.Split(b.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.Trim(strings.Join(strings.Fields(l), " "), "| ")
+	}
+	text := htmlBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	doc.Sections = []DocumentSection{{Text: strings.TrimSpace(text)}}
+	return doc, nil
+}
+
+func htmlNodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var s strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		s.WriteString(htmlNodeText(c))
+	}
+	return s.String()
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// ------------------
+// PDF
+// ------------------
+
+type pdfLoader struct{}
+
+// Load extracts the text layer page by page; each page is a section with
+// its 1-based "page" number. Scanned PDFs without a text layer yield no
+// text, and encrypted ones fail to open.
+func (pdfLoader) Load(_ string, data []byte) (*Document, error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("opening PDF: %w", err)
+	}
+
+	doc := &Document{Format: "pdf"}
+	if info := r.Trailer().Key("Info"); !info.IsNull() {
+		doc.Title = strings.TrimSpace(info.Key("Title").Text())
+	}
+
+	for i := 1; i <= r.NumPage(); i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		lines := pdfLines(p.Content().Text)
+		if len(lines) == 0 {
+			continue
+		}
+		doc.Sections = append(doc.Sections, DocumentSection{
+			Text: strings.Join(lines, "\n"),
+			Meta: map[string]interface{}{"page": i},
+		})
+	}
+	return doc, nil
+}
+
+// pdfLines lays out the glyphs of a page, in content-stream order, as lines
+// of text: a vertical jump starts a new line, and a horizontal gap wider than
+// a fraction of the font size (a word space drawn by positioning rather than
+// a space glyph) becomes a space.
+func pdfLines(glyphs []pdf.Text) []string {
+	var lines []string
+	var line strings.Builder
+	flush := func() {
+		if s := strings.Join(strings.Fields(line.String()), " "); s != "" {
+			lines = append(lines, s)
+		}
+		line.Reset()
+	}
+	var prev *pdf.Text
+	for i := range glyphs {
+		g := &glyphs[i]
+		if prev != nil {
+			size := max(prev.FontSize, 1)
+			switch {
+			case math.Abs(g.Y-prev.Y) > size/2:
+				flush()
+			case prev.W > 0 && g.X-(prev.X+prev.W) > size*0.15:
+				line.WriteByte(' ')
+			}
+		}
+		line.WriteString(g.S)
+		prev = g
+	}
+	flush()
+	return lines
+}
+
+// ------------------
+// DOCX
+// ------------------
+
+type docxLoader struct{}
+
+const wordprocessingNS = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+func isDocx(data []byte) bool {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the paragraphs of word/document.xml, one per line, with a blank
+// line before headings. The title comes from the document properties, or
+// the first paragraph styled "Title".
+func (docxLoader) Load(_ string, data []byte) (*Document, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("opening DOCX: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	body, ok := files["word/document.xml"]
+	if !ok {
+		return nil, fmt.Errorf("opening DOCX: word/document.xml is missing")
+	}
+
+	doc := &Document{Format: "docx"}
+	if core, ok := files["docProps/core.xml"]; ok {
+		var props struct {
+			Title string `xml:"title"`
+		}
+		if rc, err := core.Open(); err == nil {
+			if err := xml.NewDecoder(rc).Decode(&props); err == nil {
+				doc.Title = strings.TrimSpace(props.Title)
+			}
+			rc.Close()
+		}
+	}
+
+	rc, err := body.Open()
+	if err != nil {
+		return nil, fmt.Errorf("reading word/document.xml: %w", err)
+	}
+	defer rc.Close()
+
+	var (
+		out       []string
+		para      strings.Builder
+		style     string
+		inText    bool
+		dec       = xml.NewDecoder(rc)
+		paragraph = 0
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing word/document.xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != wordprocessingNS {
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				style = ""
+			case "pStyle":
+				for _, a := range t.Attr {
+					if a.Name.Local == "val" {
+						style = a.Value
+					}
+				}
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteString("\t")
+			case "br", "cr":
+				para.WriteString("\n")
+			}
+		case xml.EndElement:
+			if t.Name.Space != wordprocessingNS {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				s := strings.TrimSpace(para.String())
+				if s == "" {
+					continue
+				}
+				paragraph++
+				heading := style == "Title" || strings.HasPrefix(style, "Heading")
+				if style == "Title" && doc.Title == "" {
+					doc.Title = s
+				}
+				if heading && paragraph > 1 {
+					out = append(out, "")
+				}
+				out = append(out, s)
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+
+	doc.Sections = []DocumentSection{{Text: strings.Join(out, "\n")}}
+	return doc, nil
+}
+
+// ------------------
+// CSV
+// ------------------
+
+type csvLoader struct {
+	comma rune
+}
+
+// Load renders each record as one "column: value; ..." paragraph, using the
+// first row as column names. Empty values are left out.
+func (l csvLoader) Load(_ string, data []byte) (*Document, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = l.comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return textDocument("csv", ""), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+
+	var records []string
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+		var fields []string
+		for i, v := range rec {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			name := fmt.Sprintf("column %d", i+1)
+			if i < len(header) && header[i] != "" {
+				name = header[i]
+			}
+			fields = append(fields, name+": "+v)
+		}
+		if len(fields) > 0 {
+			records = append(records, strings.Join(fields, "; "))
+		}
+	}
+	return textDocument("csv", strings.Join(records, "\n\n")), nil
+}
+
+// ------------------
+// JSON / JSONL
+// ------------------
+
+type jsonLoader struct {
+	lines bool
+}
+
+// jsonTextFields are the record fields, tried in order, that hold the text to
+// index (RAG_JSON_TEXT_FIELDS). Dotted names reach into nested objects.
+func jsonTextFields() []string {
+	var fields []string
+	for _, f := range strings.Split(currentConfig.JSONTextFields, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		fields = []string{"text", "content", "body"}
+	}
+	return fields
+}
+
+// Load indexes each record (a line of a JSONL file, an element of a
+// top-level array, or a lone object) as a section of its own, numbered by
+// "record". A record's text is the first of the configured text fields it
+// has; records with none are rendered as "key: value" lines instead. A
+// "title" field becomes the record's title.
+func (l jsonLoader) Load(_ string, data []byte) (*Document, error) {
+	var records []interface{}
+	if l.lines {
+		for n, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(line), &v); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			records = append(records, v)
+		}
+	} else {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("decoding JSON: %w", err)
+		}
+		if arr, ok := v.([]interface{}); ok {
+			records = arr
+		} else {
+			records = []interface{}{v}
+		}
+	}
+
+	doc := &Document{Format: "json"}
+	if l.lines {
+		doc.Format = "jsonl"
+	}
+	fields := jsonTextFields()
+	for i, rec := range records {
+		text := ""
+		meta := map[string]interface{}{"record": i + 1}
+		if obj, ok := rec.(map[string]interface{}); ok {
+			for _, f := range fields {
+				if s := jsonFieldText(obj, f); s != "" {
+					text = s
+					break
+				}
+			}
+			if title, ok := obj["title"].(string); ok && strings.TrimSpace(title) != "" {
+				meta["record_title"] = strings.TrimSpace(title)
+			}
+		}
+		if text == "" {
+			text = renderJSON(rec)
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		doc.Sections = append(doc.Sections, DocumentSection{Text: text, Meta: meta})
+	}
+	return doc, nil
+}
+
+// jsonFieldText returns the text at a dotted field path: a string, or the
+// strings of an array joined by blank lines.
+func jsonFieldText(obj map[string]interface{}, field string) string {
+	var v interface{} = obj
+	for _, part := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[part]
+	}
+	switch x := v.(type) {
+	case string:
+		return strings.TrimSpace(x)
+	case []interface{}:
+		var parts []string
+		for _, e := range x {
+			if s, ok := e.(string); ok && strings.TrimSpace(s) != "" {
+				parts = append(parts, strings.TrimSpace(s))
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
+
+// renderJSON flattens a value into "key.path: value" lines, sorted by key.
+func renderJSON(v interface{}) string {
+	var lines []string
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(x))
+			for k := range x {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				key := k
+				if prefix != "" {
+					key = prefix + "." + k
+				}
+				walk(key, x[k])
+			}
+		case []interface{}:
+			for i, e := range x {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), e)
+			}
+		case nil:
+		default:
+			s := strings.TrimSpace(fmt.Sprint(x))
+			if f, ok := x.(float64); ok {
+				s = strconv.FormatFloat(f, 'f', -1, 64)
+			}
+			if s == "" {
+				return
+			}
+			if prefix == "" {
+				lines = append(lines, s)
+			} else {
+				lines = append(lines, prefix+": "+s)
+			}
+		}
+	}
+	walk("", v)
+	return strings.Join(lines, "\n")
+}
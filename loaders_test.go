@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownLoaderHeadingPaths(t *testing.T) {
+	src := strings.Join([]string{
+		"---",
+		"title: Handbook",
+		"---",
+		"Intro text.",
+		"",
+		"# Policy",
+		"Top.",
+		"## Travel",
+		"### Per diem",
+		"Daily **rates** apply.",
+		"```",
+		"# not a heading",
+		"```",
+		"## Leave",
+		"- Annual [leave](leave.md).",
+	}, "\n")
+	doc, err := markdownLoader{}.Load("handbook.md", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Title != "Handbook" {
+		t.Fatalf("title = %q, want Handbook", doc.Title)
+	}
+
+	want := []struct{ heading, text string }{
+		{"", "Intro text."},
+		{"Policy", "Top."},
+		// "Travel" has no text of its own, so it yields no section.
+		{"Policy > Travel > Per diem", "Daily rates apply.\n# not a heading"},
+		{"Policy > Leave", "Annual leave."},
+	}
+	if len(doc.Sections) != len(want) {
+		t.Fatalf("got %d sections, want %d: %+v", len(doc.Sections), len(want), doc.Sections)
+	}
+	for i, w := range want {
+		s := doc.Sections[i]
+		if s.Heading != w.heading || s.Text != w.text {
+			t.Fatalf("section %d = (%q, %q), want (%q, %q)", i, s.Heading, s.Text, w.heading, w.text)
+		}
+		if hp, _ := s.Meta["heading_path"].(string); hp != w.heading {
+			t.Fatalf("section %d heading_path = %q, want %q", i, hp, w.heading)
+		}
+	}
+}
+
+func TestCSVLoaderRows(t *testing.T) {
+	cases := []struct {
+		comma rune
+		src   string
+		want  string
+	}{
+		{',', "", ""},
+		{',', "name,city\n", ""},
+		{',', "\ufeffname, city\nAda,London\n", "name: Ada; city: London"},
+		// Empty values are left out, blank rows dropped, extra columns numbered.
+		{',', "name,city\nBob,\n,\nCy,Paris,extra\n", "name: Bob\n\nname: Cy; city: Paris; column 3: extra"},
+		{',', "name,note\n\"Lee, J\",\"says \"\"hi\"\"\"\n", `name: Lee, J; note: says "hi"`},
+		{'\t', "name\tcity\nAda\tLondon\n", "name: Ada; city: London"},
+	}
+	for _, tc := range cases {
+		doc, err := csvLoader{comma: tc.comma}.Load("t.csv", []byte(tc.src))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.src, err)
+		}
+		if len(doc.Sections) != 1 || doc.Sections[0].Text != tc.want {
+			t.Fatalf("%q: sections = %+v, want one with %q", tc.src, doc.Sections, tc.want)
+		}
+	}
+}
+
+func TestJSONLoaderFields(t *testing.T) {
+	saved := currentConfig.JSONTextFields
+	defer func() { currentConfig.JSONTextFields = saved }()
+	currentConfig.JSONTextFields = "doc.body, text"
+
+	cases := []struct {
+		lines bool
+		src   string
+		want  []string // section texts
+		title string   // record_title of the first record
+	}{
+		{
+			src:   `[{"doc": {"body": "Nested"}, "text": "flat", "title": " Guide "}, {"text": "Only flat"}]`,
+			want:  []string{"Nested", "Only flat"},
+			title: "Guide",
+		},
+		{
+			src:  `{"doc": {"body": ["a", " ", "b"]}}`,
+			want: []string{"a\n\nb"},
+		},
+		{
+			// No text field: rendered as sorted dotted key lines.
+			src:  `{"n": 1.5, "tags": ["x"], "doc": {"id": 7, "empty": null}}`,
+			want: []string{"doc.id: 7\nn: 1.5\ntags[0]: x"},
+		},
+		{
+			lines: true,
+			src:   "{\"text\": \"one\"}\n\n{\"text\": \"two\"}\n",
+			want:  []string{"one", "two"},
+		},
+	}
+	for _, tc := range cases {
+		doc, err := jsonLoader{lines: tc.lines}.Load("t.json", []byte(tc.src))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.src, err)
+		}
+		var got []string
+		for i, s := range doc.Sections {
+			got = append(got, s.Text)
+			if s.Meta["record"] != i+1 {
+				t.Fatalf("%s: section %d record = %v", tc.src, i, s.Meta["record"])
+			}
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tc.want) {
+			t.Fatalf("%s: texts = %q, want %q", tc.src, got, tc.want)
+		}
+		if title, _ := doc.Sections[0].Meta["record_title"].(string); title != tc.title {
+			t.Fatalf("%s: record_title = %q, want %q", tc.src, title, tc.title)
+		}
+	}
+
+	if _, err := (jsonLoader{lines: true}).Load("t.jsonl", []byte("{\"text\": \"ok\"}\n{bad\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("torn JSONL line: err = %v, want a line 2 error", err)
+	}
+}
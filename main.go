@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
@@ -12,13 +13,11 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/joho/godotenv"
-	"github.com/tmc/langchaingo/agents"
-	"github.com/tmc/langchaingo/chains"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/openai"
-	"github.com/tmc/langchaingo/tools"
 )
 
 type RagChunk struct {
@@ -43,7 +42,9 @@ func chunkText(text string, chunkSize int) []string {
 		return nil
 	}
 
-	// Very simple chunker: split on paragraphs, then hard-wrap.
+	// Very simple chunker: split on paragraphs, then wrap at the last space
+	// before chunkSize bytes (or the last rune boundary, for a run without
+	// spaces).
 	var chunks []string
 	paras := strings.Split(text, "\n\n")
 	for _, p := range paras {
@@ -52,8 +53,18 @@ func chunkText(text string, chunkSize int) []string {
 			continue
 		}
 		for len(p) > chunkSize {
-			chunks = append(chunks, strings.TrimSpace(p[:chunkSize]))
-			p = strings.TrimSpace(p[chunkSize:])
+			cut := strings.LastIndexAny(p[:chunkSize+1], " \t\n")
+			if cut <= 0 {
+				cut = chunkSize
+				for cut > 0 && !utf8.RuneStart(p[cut]) {
+					cut--
+				}
+				if cut == 0 {
+					_, cut = utf8.DecodeRuneInString(p)
+				}
+			}
+			chunks = append(chunks, strings.TrimSpace(p[:cut]))
+			p = strings.TrimSpace(p[cut:])
 		}
 		if p != "" {
 			chunks = append(chunks, p)
@@ -63,23 +74,50 @@ func chunkText(text string, chunkSize int) []string {
 }
 
 var (
-	conversationLog []string
+	// conversationLog is the in-process transcript (prior turns plus this
+	// run). It is replayed to the agent as memory, not just printed.
+	conversationLog []llms.ChatMessage
 	llmClient       llms.Model
 
 	hfEmbedderConcrete Embedder
-
-	// BM25 corpus cache for rag_docs (hybrid retrieval)
-	bm25Index *BM25Index
 )
 
 type Config struct {
-	OpenRouterAPIKey string // OPENROUTER_API_KEY (required)
+	OpenRouterAPIKey string // OPENROUTER_API_KEY (required for the openrouter backend)
 	HFAPIKey         string // HF_API_KEY (required)
 	OpenRouterModel  string // OPENROUTER_MODEL (default: required model)
+	AgentMode        string // AGENT_MODE (react or tools; default: react)
+	LLMBackend       string // LLM_BACKEND (openrouter or gemini; default: openrouter)
+	GeminiAPIKey     string // GEMINI_API_KEY (required for the gemini backend)
+	GeminiModel      string // GEMINI_MODEL (default: gemini-2.5-flash)
 	EmbedModelName   string // EMBEDDING_MODEL (default: sentence-transformers/all-MiniLM-L6-v2)
 	ChromaDBHost     string // CHROMA_DB_HOST (default: http://localhost:8000)
 	RAGDataDir       string // RAG_DATA_DIR (default: ./data)
-	ChunkLength      int    // CHUNK_LENGTH (default: 800)
+	Chunker          string // CHUNKER (tokens or paragraph; default: tokens)
+	ChunkTokens      int    // CHUNK_TOKENS (default: 0, the embedding model's maximum)
+	ChunkOverlap     int    // CHUNK_OVERLAP (tokens; default: 32)
+	ChunkTokenizer   string // CHUNK_TOKENIZER (wordpiece, tiktoken or estimate; default: wordpiece)
+	ChunkLength      int    // CHUNK_LENGTH (bytes, paragraph chunker only; default: 800)
+	JSONTextFields   string // RAG_JSON_TEXT_FIELDS (comma-separated, tried in order; default: text,content,body)
+	IngestInclude    string // RAG_INCLUDE (comma-separated patterns; default: every file)
+	IngestExclude    string // RAG_EXCLUDE (comma-separated .ragignore patterns; default: unset)
+	MaxFileSize      int64  // RAG_MAX_FILE_SIZE (bytes, or with a KB/MB/GB unit; default: 10MB, 0 disables)
+	FollowSymlinks   bool   // RAG_FOLLOW_SYMLINKS (default: false)
+	StateDir         string // RAG_STATE_DIR (default: ./.toolrag)
+	ReconcileDryRun  bool   // RAG_RECONCILE_DRY_RUN (default: false)
+	ExpandMode       string // RAG_EXPAND (none, neighbours or section; default: none)
+	ExpandNeighbours int    // RAG_EXPAND_NEIGHBOURS (chunks either side; default: 1)
+	ContextBudget    int    // RAG_CONTEXT_BUDGET (bytes of document text; default: 6000, 0 disables)
+	FlightDataPath   string // FLIGHT_DATA_PATH (JSON or CSV schedule; default: ./fixtures/flights.json)
+	HotelDataPath    string // HOTEL_DATA_PATH (JSON catalog; default: ./fixtures/hotels.json)
+	RatesPath        string // RATES_PATH (JSON or CSV rate snapshot; default: ./fixtures/rates.json)
+	HistoryLast      int    // HISTORY_LAST (default: 20, 0 prints every turn)
+	HistorySince     string // HISTORY_SINCE (RFC3339 time or duration like 72h or 7d; default: unset)
+	Stream           bool   // STREAM (default: true)
+	SessionID        string // SESSION_ID (default: default)
+	UserID           string // USER_ID (default: $USER)
+	ServeAddr        string // SERVE_ADDR (default: :8080)
+	BatchConcurrency int    // BATCH_CONCURRENCY (default: 4)
 }
 
 var currentConfig Config
@@ -96,18 +134,119 @@ func loadConfigFromEnv() Config {
 		}
 	}
 
+	maxFileSize := int64(10 << 20)
+	if v := os.Getenv("RAG_MAX_FILE_SIZE"); v != "" {
+		if n, err := parseByteSize(v); err == nil {
+			maxFileSize = n
+		}
+	}
+
+	chunkTokens := 0
+	if v := os.Getenv("CHUNK_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			chunkTokens = n
+		}
+	}
+	chunkOverlap := 32
+	if v := os.Getenv("CHUNK_OVERLAP"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			chunkOverlap = n
+		}
+	}
+
+	expandNeighbours := 1
+	if v := os.Getenv("RAG_EXPAND_NEIGHBOURS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			expandNeighbours = n
+		}
+	}
+	contextBudget := 6000
+	if v := os.Getenv("RAG_CONTEXT_BUDGET"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			contextBudget = n
+		}
+	}
+
+	historyLast := 20
+	if v := os.Getenv("HISTORY_LAST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			historyLast = n
+		}
+	}
+
+	batchConcurrency := 4
+	if v := os.Getenv("BATCH_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			batchConcurrency = n
+		}
+	}
+
 	return Config{
 		OpenRouterAPIKey: os.Getenv("OPENROUTER_API_KEY"),
 		HFAPIKey:         os.Getenv("HF_API_KEY"),
 		OpenRouterModel:  getEnvWithDefault("OPENROUTER_MODEL", "nvidia/nemotron-3-nano-30b-a3b:free"),
+		AgentMode:        getEnvWithDefault("AGENT_MODE", agentModeReact),
+		LLMBackend:       getEnvWithDefault("LLM_BACKEND", backendOpenRouter),
+		GeminiAPIKey:     os.Getenv("GEMINI_API_KEY"),
+		GeminiModel:      getEnvWithDefault("GEMINI_MODEL", "gemini-2.5-flash"),
 		EmbedModelName:   getEnvWithDefault("EMBEDDING_MODEL", "sentence-transformers/all-MiniLM-L6-v2"),
 		ChromaDBHost:     getEnvWithDefault("CHROMA_DB_HOST", "http://localhost:8000"),
 		RAGDataDir:       getEnvWithDefault("RAG_DATA_DIR", "./data"),
+		Chunker:          getEnvWithDefault("CHUNKER", chunkerTokens),
+		ChunkTokens:      chunkTokens,
+		ChunkOverlap:     chunkOverlap,
+		ChunkTokenizer:   getEnvWithDefault("CHUNK_TOKENIZER", tokenizerWordPiece),
 		ChunkLength:      chunkLen,
+		JSONTextFields:   getEnvWithDefault("RAG_JSON_TEXT_FIELDS", "text,content,body"),
+		IngestInclude:    os.Getenv("RAG_INCLUDE"),
+		IngestExclude:    os.Getenv("RAG_EXCLUDE"),
+		MaxFileSize:      maxFileSize,
+		FollowSymlinks:   os.Getenv("RAG_FOLLOW_SYMLINKS") == "true",
+		StateDir:         getEnvWithDefault("RAG_STATE_DIR", "./.toolrag"),
+		ReconcileDryRun:  os.Getenv("RAG_RECONCILE_DRY_RUN") == "true",
+		ExpandMode:       getEnvWithDefault("RAG_EXPAND", expandNone),
+		ExpandNeighbours: expandNeighbours,
+		ContextBudget:    contextBudget,
+		FlightDataPath:   getEnvWithDefault("FLIGHT_DATA_PATH", "./fixtures/flights.json"),
+		HotelDataPath:    getEnvWithDefault("HOTEL_DATA_PATH", "./fixtures/hotels.json"),
+		RatesPath:        getEnvWithDefault("RATES_PATH", "./fixtures/rates.json"),
+		HistoryLast:      historyLast,
+		HistorySince:     os.Getenv("HISTORY_SINCE"),
+		Stream:           os.Getenv("STREAM") != "false",
+		SessionID:        getEnvWithDefault("SESSION_ID", defaultSessionID),
+		UserID:           getEnvWithDefault("USER_ID", getEnvWithDefault("USER", "anonymous")),
+		ServeAddr:        getEnvWithDefault("SERVE_ADDR", ":8080"),
+		BatchConcurrency: batchConcurrency,
 	}
 }
 
-func loadDocumentsFromDataDir(ctx context.Context) error {
+func manifestPath() string {
+	return filepath.Join(currentConfig.StateDir, "manifest.json")
+}
+
+// IngestSummary reports what one ingestion run did.
+type IngestSummary struct {
+	Paths          []string `json:"paths"`
+	ChunksIndexed  int      `json:"chunks_indexed"`
+	ChangedFiles   int      `json:"changed_files"`
+	UnchangedFiles int      `json:"unchanged_files"`
+	StaleChunks    int      `json:"stale_chunks"`
+	RemovedChunks  int      `json:"removed_chunks"`
+	DryRun         bool     `json:"dry_run"`
+	// Skipped lists what was left out by .ragignore, RAG_INCLUDE /
+	// RAG_EXCLUDE, size, content or symlink policy.
+	Skipped []SkippedFile `json:"skipped"`
+}
+
+// Changed reports whether rag_docs changed, so callers know to save the BM25
+// index.
+func (s *IngestSummary) Changed() bool {
+	return s != nil && (s.ChunksIndexed > 0 || s.RemovedChunks > 0)
+}
+
+// loadDocumentsFromDataDir ingests RAG_DATA_DIR, creating it if it does not
+// exist yet. It reports whether anything changed.
+func loadDocumentsFromDataDir(ctx context.Context) (bool, error) {
 	dataDir := currentConfig.RAGDataDir
 	if dataDir == "" {
 		dataDir = "./data"
@@ -117,101 +256,308 @@ func loadDocumentsFromDataDir(ctx context.Context) error {
 	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
 		log.Printf("Data directory does not exist, creating: %s", dataDir)
 		if err := os.MkdirAll(dataDir, 0755); err != nil {
-			return fmt.Errorf("failed to create data directory: %w", err)
+			return false, fmt.Errorf("failed to create data directory: %w", err)
 		}
-		return nil
+		return false, nil
+	}
+
+	summary, err := ingestPaths(ctx, []string{dataDir}, currentConfig.ReconcileDryRun)
+	return summary.Changed(), err
+}
+
+// ingestPaths indexes new and changed files under each root (a directory or
+// a single file) into rag_docs and its BM25 index, and removes chunks of
+// files under the roots that are gone from both. Chunks of sources outside
+// the roots are left alone. With dryRun set, stale chunks are only reported.
+func ingestPaths(ctx context.Context, roots []string, dryRun bool) (*IngestSummary, error) {
+	summary := &IngestSummary{DryRun: dryRun, Skipped: []SkippedFile{}}
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if _, err := os.Stat(root); err != nil {
+			return summary, err
+		}
+		summary.Paths = append(summary.Paths, root)
 	}
 
 	if ragDocsCollection == nil {
-		return fmt.Errorf("ragDocsCollection not initialized")
+		return summary, fmt.Errorf("ragDocsCollection not initialized")
 	}
 	if hfEmbedderConcrete == nil {
-		return fmt.Errorf("HF embedder not initialized")
+		return summary, fmt.Errorf("HF embedder not initialized")
 	}
+	if ragChunker == nil {
+		return summary, fmt.Errorf("chunker not initialized: %w", ragChunkerErr)
+	}
+	lexical := lexicalIndex(ragDocsCollection)
 
-	chunkSize := currentConfig.ChunkLength
-	if chunkSize <= 0 {
-		chunkSize = 800
+	manifest, err := loadIngestManifest(manifestPath(), ragChunker.Signature(), currentConfig.EmbedModelName)
+	if err != nil {
+		return summary, err
+	}
+
+	// live collects every chunk ID that should exist after this run; seen
+	// tracks which manifest entries still have a file behind them.
+	live := map[string]bool{}
+	seen := map[string]bool{}
+	keepExisting := func(path string) {
+		if e, ok := manifest.Files[path]; ok {
+			seen[path] = true
+			for _, id := range e.ChunkIDs {
+				live[id] = true
+			}
+		}
 	}
 
-	var corpus []BM25Doc
-	documentChunks := 0
+	// filter holds the skip rules of the root being walked; visited the
+	// real paths of directories already walked, so following a symlink
+	// cannot loop.
+	var filter *ingestFilter
+	visited := map[string]bool{}
+	skip := func(path, reason string) {
+		summary.Skipped = append(summary.Skipped, SkippedFile{Path: path, Reason: reason})
+	}
 
-	err := filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+	var walk fs.WalkDirFunc
+	walk = func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if reason := filter.skipPath(path, d.IsDir()); reason != "" {
+			skip(path, reason)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if d.IsDir() {
 			return nil
 		}
 
+		// Symlinks are followed for the root itself, which was named
+		// explicitly, and otherwise only with RAG_FOLLOW_SYMLINKS. Links are
+		// ingested under their own path.
+		if d.Type()&fs.ModeSymlink != 0 {
+			if !filter.follow && path != filter.root {
+				skip(path, "symlink (RAG_FOLLOW_SYMLINKS is off)")
+				return nil
+			}
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				skip(path, "broken symlink")
+				return nil
+			}
+			info, err := os.Stat(target)
+			if err != nil {
+				skip(path, "broken symlink")
+				return nil
+			}
+			if !info.IsDir() {
+				return walk(path, fs.FileInfoToDirEntry(info), nil)
+			}
+			if visited[target] && path != filter.root {
+				skip(path, "symlink loop")
+				return nil
+			}
+			visited[target] = true
+			return filepath.WalkDir(target, func(p string, d fs.DirEntry, err error) error {
+				rel, relErr := filepath.Rel(target, p)
+				if relErr != nil {
+					return relErr
+				}
+				return walk(filepath.Join(path, rel), d, err)
+			})
+		}
+
+		// Files that cannot be read this time keep their existing chunks;
+		// only files that are gone or changed lose them. Skipped files lose
+		// them too.
+		info, err := d.Info()
+		if err != nil {
+			log.Printf("Failed to stat file %s: %v", path, err)
+			keepExisting(path)
+			return nil
+		}
+		if reason := filter.skipSize(info.Size()); reason != "" {
+			skip(path, reason)
+			return nil
+		}
+		unchanged, sum, err := manifest.Unchanged(path, info)
+		if err != nil {
+			log.Printf("Failed to hash file %s: %v", path, err)
+			keepExisting(path)
+			return nil
+		}
+
+		// Unchanged files are already embedded in rag_docs and covered by the
+		// persisted BM25 index, so they are not even read.
+		if unchanged {
+			summary.UnchangedFiles++
+			keepExisting(path)
+			return nil
+		}
+
 		raw, err := os.ReadFile(path)
 		if err != nil {
 			log.Printf("Failed to read file %s: %v", path, err)
+			keepExisting(path)
 			return nil
 		}
 
-		text := strings.TrimSpace(string(raw))
-		if text == "" {
+		if looksBinary(path, raw) {
+			skip(path, "binary")
+			return nil
+		}
+		doc, err := loadDocument(path, raw)
+		if errors.Is(err, errUnsupportedFormat) {
+			skip(path, err.Error())
+			return nil
+		}
+		if err != nil {
+			log.Printf("Failed to load file %s: %v", path, err)
+			keepExisting(path)
 			return nil
 		}
 
-		chunks := chunkText(text, chunkSize)
+		chunks := chunkDocument(doc, ragChunker)
 		if len(chunks) == 0 {
+			skip(path, "no text")
 			return nil
 		}
 
-		embedInputs := make([]Chunk, 0, len(chunks))
-		for i, c := range chunks {
-			id := stableID("rag", path, fmt.Sprintf("%d", i))
-			embedInputs = append(embedInputs, Chunk{ID: id, Text: c})
+		for i := range chunks {
+			live[ragChunkID(path, i)] = true
 		}
+		seen[path] = true
 
-		vecs, err := hfEmbedderConcrete.Embed(ctx, embedInputs)
+		chunkIDs, failed, err := indexChunks(ctx, path, chunks)
 		if err != nil {
-			return fmt.Errorf("embedding %s: %w", path, err)
+			return err
 		}
-
-		for i, c := range chunks {
-			id := embedInputs[i].ID
-			vec := vecs[id]
-			meta := map[string]interface{}{
-				"source": path,
-				"type":   "document",
-				"chunk":  i,
+		summary.ChunksIndexed += len(chunkIDs)
+
+		// Only record the file once every chunk made it into Chroma, so a
+		// partial failure is retried on the next run.
+		if !failed {
+			manifest.Files[path] = &ManifestEntry{
+				Path:     path,
+				Size:     info.Size(),
+				ModTime:  info.ModTime(),
+				SHA256:   sum,
+				ChunkIDs: chunkIDs,
 			}
-			if err := chromaUpsert(ctx, ragDocsCollection, id, c, vec, meta); err != nil {
-				log.Printf("Warning: upsert failed for %s chunk %d: %v", path, i, err)
-				continue
-			}
-			documentChunks++
-
-			corpus = append(corpus, BM25Doc{ID: id, Text: c})
 		}
+		summary.ChangedFiles++
 
 		return nil
-	})
+	}
+	for _, root := range summary.Paths {
+		if filter, err = newIngestFilter(root); err != nil {
+			return summary, err
+		}
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			visited[real] = true
+		}
+		if err := filepath.WalkDir(root, walk); err != nil {
+			if saveErr := manifest.Save(manifestPath()); saveErr != nil {
+				log.Printf("Warning: failed to save ingestion manifest: %v", saveErr)
+			}
+			return summary, err
+		}
+	}
+
+	// Drop chunks of files that were deleted, renamed, emptied or now produce
+	// fewer chunks. Only done after a complete walk, otherwise files the walk
+	// never reached would look deleted.
+	report, err := reconcileRagDocs(ctx, summary.Paths, live, dryRun)
 	if err != nil {
-		return err
+		log.Printf("Warning: failed to reconcile rag_docs: %v", err)
+	}
+	report.Log()
+	if report != nil {
+		summary.StaleChunks = len(report.Orphans)
+		summary.RemovedChunks = report.Deleted
+		if report.Deleted > 0 {
+			lexical.Remove(report.Orphans...)
+		}
+	}
+	if err == nil && !dryRun {
+		for path := range manifest.Files {
+			if !seen[path] && withinAnyDir(summary.Paths, path) {
+				delete(manifest.Files, path)
+			}
+		}
+	}
+	if err := manifest.Save(manifestPath()); err != nil {
+		log.Printf("Warning: failed to save ingestion manifest: %v", err)
 	}
 
-	if documentChunks > 0 {
-		log.Printf("Indexed %d chunks from %s", documentChunks, dataDir)
+	where := strings.Join(summary.Paths, ", ")
+	if summary.ChunksIndexed > 0 {
+		log.Printf("Indexed %d chunks from %d changed files in %s", summary.ChunksIndexed, summary.ChangedFiles, where)
 	}
+	if summary.UnchangedFiles > 0 {
+		log.Printf("Skipped %d unchanged files in %s", summary.UnchangedFiles, where)
+	}
+	if len(summary.Skipped) > 0 {
+		log.Printf("Left out %d files and directories in %s:", len(summary.Skipped), where)
+		for _, sk := range summary.Skipped {
+			log.Printf("  %s: %s", sk.Path, sk.Reason)
+		}
+	}
+	return summary, nil
+}
 
-	// Build BM25 corpus for hybrid retrieval
-	bm25Index = NewBM25Index(corpus)
+// ragChunkID is the rag_docs ID of chunk i of source.
+func ragChunkID(source string, i int) string {
+	return stableID("rag", source, fmt.Sprintf("%d", i))
+}
 
-	return nil
+// indexChunks embeds the chunks of one source and upserts them into rag_docs
+// and its BM25 index under ragChunkID IDs, with each chunk's metadata next to
+// source, type and chunk index. It returns the IDs that were stored; failed
+// reports chunks whose upsert failed (logged and skipped), while err means
+// nothing could be embedded.
+func indexChunks(ctx context.Context, source string, chunks []TextChunk) (chunkIDs []string, failed bool, err error) {
+	embedInputs := make([]Chunk, 0, len(chunks))
+	for i, c := range chunks {
+		embedInputs = append(embedInputs, Chunk{ID: ragChunkID(source, i), Text: c.Text})
+	}
+
+	vecs, err := hfEmbedderConcrete.Embed(ctx, embedInputs)
+	if err != nil {
+		return nil, false, fmt.Errorf("embedding %s: %w", source, err)
+	}
+
+	lexical := lexicalIndex(ragDocsCollection)
+	chunkIDs = make([]string, 0, len(chunks))
+	for i, c := range chunks {
+		id := embedInputs[i].ID
+		meta := make(map[string]interface{}, len(c.Meta)+3)
+		for k, v := range c.Meta {
+			meta[k] = v
+		}
+		meta["source"] = source
+		meta["type"] = "document"
+		meta["chunk"] = i
+		if err := chromaUpsert(ctx, ragDocsCollection, id, c.Text, vecs[id], meta); err != nil {
+			log.Printf("Warning: upsert failed for %s chunk %d: %v", source, i, err)
+			failed = true
+			continue
+		}
+		chunkIDs = append(chunkIDs, id)
+		lexical.Update(BM25Doc{ID: id, Text: c.Text})
+	}
+	return chunkIDs, failed, nil
 }
 
-func storeConversationHistory(ctx context.Context, userMsg, assistantMsg string) {
+func storeConversationHistory(ctx context.Context, session Session, userMsg, assistantMsg string) {
 	if conversationCollection == nil || hfEmbedderConcrete == nil {
 		return
 	}
 
 	conversation := fmt.Sprintf("User: %s\nAssistant: %s", userMsg, assistantMsg)
-	id := stableID("conv", time.Now().Format(time.RFC3339Nano), userMsg, assistantMsg)
+	now := time.Now()
+	id := stableID("conv", now.Format(time.RFC3339Nano), userMsg, assistantMsg)
 
 	vecs, err := hfEmbedderConcrete.Embed(ctx, []Chunk{{ID: id, Text: conversation}})
 	if err != nil {
@@ -221,42 +567,72 @@ func storeConversationHistory(ctx context.Context, userMsg, assistantMsg string)
 
 	meta := map[string]interface{}{
 		"type":      "conversation",
-		"timestamp": time.Now().Format(time.RFC3339),
+		"timestamp": now.Format(time.RFC3339Nano),
+		"session":   session.ID,
+		"user":      session.UserID,
 	}
 	if err := chromaUpsert(ctx, conversationCollection, id, conversation, vecs[id], meta); err != nil {
 		log.Printf("Warning: Failed to store conversation: %v", err)
+		return
 	}
+
+	lexicalIndex(conversationCollection).Add(BM25Doc{ID: id, Text: conversation})
+	markBM25Dirty(conversationCollection)
 }
 
-func queryInternalKnowledge(ctx context.Context, query string) (string, error) {
+func queryInternalKnowledge(ctx context.Context, session Session, query string) (string, error) {
 	if hfEmbedderConcrete == nil || ragDocsCollection == nil || conversationCollection == nil {
 		return "Internal knowledge base not initialized.", nil
 	}
 
-	// Hybrid retrieve from rag_docs and also vector-retrieve from conversation memory.
-	docResults, err := hybridRetrieve(ctx, ragDocsCollection, query, 4)
+	// Hybrid retrieve from rag_docs and conversation memory, each fused with
+	// its own BM25 index. Memory is limited to the session unless it opted
+	// into cross-session search.
+	docResults, err := hybridRetrieve(ctx, ragDocsCollection, query, 4, nil)
 	if err != nil {
 		return "", err
 	}
-	memResults, err := vectorRetrieve(ctx, conversationCollection, query, 3)
+	memResults, err := hybridRetrieve(ctx, conversationCollection, query, 3, session.memoryFilter())
 	if err != nil {
 		return "", err
 	}
 
+	trace := traceFrom(ctx)
+	trace.addSources(docResults...)
+	trace.addSources(memResults...)
+
 	if len(docResults) == 0 && len(memResults) == 0 {
 		return "No relevant information found in internal knowledge base.", nil
 	}
 
+	// Widen document hits to their surrounding chunks; the trace keeps the
+	// hits themselves.
+	if expanded, err := expandRetrieved(ctx, ragDocsCollection, docResults, currentConfig.ExpandMode, currentConfig.ExpandNeighbours, currentConfig.ContextBudget); err != nil {
+		log.Printf("Warning: Failed to expand retrieved chunks: %v", err)
+	} else {
+		docResults = expanded
+	}
+
 	var out []string
 	if len(docResults) > 0 {
 		out = append(out, "=== Relevant Documents (hybrid) ===")
 		for i, r := range docResults {
+			first, okFirst := metaInt(r.Meta, "chunk_first")
+			last, okLast := metaInt(r.Meta, "chunk_last")
+			if okFirst && okLast {
+				out = append(out, fmt.Sprintf("Doc %d (source: %s, chunks %d-%d):\n%s", i+1, r.Source, first, last, r.Text))
+				continue
+			}
 			out = append(out, fmt.Sprintf("Doc %d (source: %s):\n%s", i+1, r.Source, r.Text))
 		}
 	}
 	if len(memResults) > 0 {
-		out = append(out, "=== Relevant Past Conversations (vector) ===")
+		out = append(out, "=== Relevant Past Conversations (hybrid) ===")
 		for i, r := range memResults {
+			if session.CrossSession {
+				out = append(out, fmt.Sprintf("Memory %d (session: %v):\n%s", i+1, r.Meta["session"], r.Text))
+				continue
+			}
 			out = append(out, fmt.Sprintf("Memory %d:\n%s", i+1, r.Text))
 		}
 	}
@@ -268,6 +644,32 @@ func queryInternalKnowledge(ctx context.Context, query string) (string, error) {
 // Utility Functions
 // ------------------
 
+// checkAgentConfig validates the agent mode / backend combination and that
+// the backend's API key is set.
+func checkAgentConfig(cfg Config) error {
+	switch cfg.AgentMode {
+	case agentModeReact, agentModeTools:
+	default:
+		return fmt.Errorf("unknown agent mode %q (want %s or %s)", cfg.AgentMode, agentModeReact, agentModeTools)
+	}
+	switch cfg.LLMBackend {
+	case backendOpenRouter:
+		if cfg.OpenRouterAPIKey == "" {
+			return errors.New("OPENROUTER_API_KEY not set in environment")
+		}
+	case backendGemini:
+		if cfg.AgentMode != agentModeTools {
+			return fmt.Errorf("the %s backend requires --agent=%s", backendGemini, agentModeTools)
+		}
+		if cfg.GeminiAPIKey == "" {
+			return errors.New("GEMINI_API_KEY not set in environment")
+		}
+	default:
+		return fmt.Errorf("unknown LLM backend %q (want %s or %s)", cfg.LLMBackend, backendOpenRouter, backendGemini)
+	}
+	return nil
+}
+
 func getEnvWithDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -285,102 +687,133 @@ func main() {
 	}
 	currentConfig = loadConfigFromEnv()
 
-	if currentConfig.OpenRouterAPIKey == "" {
-		log.Fatal("OPENROUTER_API_KEY not set in environment")
-	}
-	if currentConfig.HFAPIKey == "" {
-		log.Fatal("HF_API_KEY not set in environment (required for embeddings)")
-	}
+	os.Exit(runCLI(os.Args[1:]))
+}
 
-	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run main.go \"<your prompt here>\"")
-	}
-	userPrompt := os.Args[1]
+// runtimeNeeds says how much of the runtime a command uses. Each level
+// includes the ones before it.
+type runtimeNeeds int
 
-	ctx := context.Background()
+const (
+	needChroma   runtimeNeeds = iota // Chroma collections
+	needIndexes                      // + the BM25 indexes
+	needEmbedder                     // + the embedder
+	needAgent                        // + the LLM, travel data and RAG_DATA_DIR ingestion
+)
 
+// checkRuntimeConfig reports missing configuration for the given level
+// before anything is started.
+func checkRuntimeConfig(cfg Config, needs runtimeNeeds) error {
+	if needs >= needAgent {
+		if err := checkAgentConfig(cfg); err != nil {
+			return err
+		}
+	}
+	if needs >= needEmbedder && cfg.HFAPIKey == "" {
+		return errors.New("HF_API_KEY not set in environment (required for embeddings)")
+	}
+	return nil
+}
+
+// initRuntime connects to Chroma and sets up as much else as needs asks
+// for: the BM25 indexes, the embedder, and for the agent the LLM client and
+// travel data, followed by ingesting RAG_DATA_DIR. Everything is set up once
+// and shared by every prompt that follows; the returned func saves BM25
+// indexes with unsaved changes and releases it.
+func initRuntime(ctx context.Context, needs runtimeNeeds) (func(), error) {
 	// Init Chroma (external service)
 	if err := initChroma(currentConfig.ChromaDBHost); err != nil {
-		log.Fatalf("failed to init chroma: %v", err)
+		return nil, fmt.Errorf("failed to init chroma: %w", err)
 	}
-	defer func() {
+	closeChroma := func() {
+		flushBM25Indexes()
 		if err := chromaClient.Close(); err != nil {
 			log.Printf("Error closing Chroma client: %v", err)
 		}
-	}()
+	}
 	if err := initChromaCollection(ctx); err != nil {
-		log.Fatalf("failed to init chroma collections: %v", err)
+		closeChroma()
+		return nil, fmt.Errorf("failed to init chroma collections: %w", err)
+	}
+	if needs < needIndexes {
+		return closeChroma, nil
+	}
+
+	// Load the persisted BM25 indexes, rebuilding them from Chroma when the
+	// saved copy is missing or out of date.
+	if err := loadLexicalIndex(ctx, ragDocsCollection); err != nil {
+		log.Printf("Warning: Failed to load BM25 index: %v", err)
+	}
+	if err := loadLexicalIndex(ctx, conversationCollection); err != nil {
+		log.Printf("Warning: Failed to load conversation BM25 index: %v", err)
+	}
+	if needs < needEmbedder {
+		return closeChroma, nil
 	}
 
 	// Init HF embedder
 	var err error
 	hfEmbedderConcrete, err = NewEmbedderFromEnv()
 	if err != nil {
-		log.Fatalf("failed to init HF embedder: %v", err)
+		closeChroma()
+		return nil, fmt.Errorf("failed to init HF embedder: %w", err)
+	}
+	// The chunker counts tokens with the embedding model's tokenizer, which
+	// is downloaded on first use. Without it ingestion fails rather than
+	// re-chunk the corpus with a different tokenizer; retrieval still works.
+	if ragChunker, ragChunkerErr = newChunkerFromConfig(ctx); ragChunkerErr != nil {
+		log.Printf("Warning: Document ingestion is disabled: %v", ragChunkerErr)
+	}
+	if needs < needAgent {
+		return closeChroma, nil
+	}
+
+	// Initialize LLM: OpenRouter (OpenAI-compatible API) serves both agent
+	// modes, Gemini only the tool-calling one.
+	switch currentConfig.LLMBackend {
+	case backendGemini:
+		toolModel, err = newGeminiToolModel(ctx, currentConfig.GeminiAPIKey, currentConfig.GeminiModel)
+	default:
+		llmClient, err = openai.New(
+			openai.WithToken(currentConfig.OpenRouterAPIKey),
+			openai.WithModel(currentConfig.OpenRouterModel),
+			openai.WithBaseURL("https://openrouter.ai/api/v1"),
+		)
+		if err == nil {
+			toolModel = newOpenRouterToolModel(llmClient)
+		}
 	}
-
-	// Initialize LLM (OpenRouter with OpenAI-compatible API)
-	llmClient, err = openai.New(
-		openai.WithToken(currentConfig.OpenRouterAPIKey),
-		openai.WithModel(currentConfig.OpenRouterModel),
-		openai.WithBaseURL("https://openrouter.ai/api/v1"),
-	)
 	if err != nil {
-		log.Fatalf("Failed to initialize LLM: %v", err)
+		closeChroma()
+		return nil, fmt.Errorf("failed to initialize LLM: %w", err)
 	}
 
-	// Index data/ documents (chunks) into rag_docs
-	if err := loadDocumentsFromDataDir(ctx); err != nil {
-		log.Printf("Warning: Failed to load documents: %v", err)
-	}
-
-	// Load prior conversation history and print it
-	fmt.Println("=== Conversation History ===")
-	prior, err := loadRecentConversationHistory(ctx, 20)
-	if err != nil {
-		log.Printf("Warning: Failed to load conversation history: %v", err)
+	// Travel data for the tools. A missing dataset only disables its tool.
+	// Assign only on success: a nil *fileFlightProvider stored in the
+	// interface would not compare equal to nil.
+	if flights, err := newFileFlightProvider(currentConfig.FlightDataPath); err != nil {
+		log.Printf("Warning: Failed to load flight data: %v", err)
+	} else {
+		flightProvider = flights
 	}
-	for _, entry := range prior {
-		fmt.Println(entry)
+	if hotels, err := newFileHotelProvider(currentConfig.HotelDataPath); err != nil {
+		log.Printf("Warning: Failed to load hotel data: %v", err)
+	} else {
+		hotelProvider = hotels
 	}
-
-	// Also store prior in in-process log so the full output includes previous runs + this run.
-	conversationLog = append(conversationLog, prior...)
-
-	// Initialize tools
-	agentTools := []tools.Tool{
-		FlightScheduleTool{},
-		HotelScheduleTool{},
-		CurrencyConverterTool{},
-		InternalKnowledgeTool{ctx: ctx},
+	if currencyRates, err = (fileRateSource{path: currentConfig.RatesPath}).LoadRates(ctx); err != nil {
+		log.Printf("Warning: Failed to load exchange rates: %v", err)
 	}
 
-	executor, err := agents.Initialize(
-		llmClient,
-		agentTools,
-		agents.ZeroShotReactDescription,
-		agents.WithMaxIterations(5),
-	)
+	// Index data/ documents (chunks) into rag_docs; the BM25 index is updated
+	// as chunks are upserted and removed.
+	changed, err := loadDocumentsFromDataDir(ctx)
 	if err != nil {
-		log.Fatalf("Failed to initialize agent: %v", err)
-	}
-
-	// Append current turn to the printed conversation log (conversation-only, not tool traces)
-	conversationLog = append(conversationLog, fmt.Sprintf("User: %s", userPrompt))
-
-	response, err := chains.Run(ctx, executor, userPrompt)
-	if err != nil {
-		log.Fatalf("Agent execution failed: %v", err)
+		log.Printf("Warning: Failed to load documents: %v", err)
 	}
-
-	conversationLog = append(conversationLog, fmt.Sprintf("Assistant: %s", response))
-	for _, entry := range conversationLog {
-		fmt.Println(entry)
+	if changed {
+		saveBM25Index(lexicalIndex(ragDocsCollection), ragDocsCollection)
 	}
 
-	// Persist conversation turn to Chroma
-	storeConversationHistory(ctx, userPrompt, response)
-
-	fmt.Println("\n=== Final Response ===")
-	fmt.Println(response)
+	return closeChroma, nil
 }
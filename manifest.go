@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The ingestion manifest records what was indexed from each file in RAG_DATA_DIR
+// so that unchanged files can be skipped on the next run instead of being
+// re-chunked and re-embedded.
+
+// Version 2 indexes files through format-specific loaders, version 3 splits
+// Markdown at headings and source code at declarations, version 4 records
+// each chunk's section range, and version 5 merges declarations up to the
+// chunk size; entries written by an older version are re-indexed.
+const manifestVersion = 5
+
+type ManifestEntry struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	SHA256   string    `json:"sha256"`
+	ChunkIDs []string  `json:"chunk_ids"`
+}
+
+type IngestManifest struct {
+	Version int `json:"version"`
+	// Chunking and embedding settings the entries were produced with. If either
+	// changes, every file has to be re-indexed.
+	Chunker    string                    `json:"chunker"`
+	EmbedModel string                    `json:"embed_model"`
+	Files      map[string]*ManifestEntry `json:"files"`
+}
+
+func newIngestManifest(chunker, embedModel string) *IngestManifest {
+	return &IngestManifest{
+		Version:    manifestVersion,
+		Chunker:    chunker,
+		EmbedModel: embedModel,
+		Files:      map[string]*ManifestEntry{},
+	}
+}
+
+// loadIngestManifest reads the manifest at path. A missing file, an unknown
+// version or different chunking/embedding settings all yield an empty manifest,
+// which makes the next ingestion a full one.
+func loadIngestManifest(path, chunker, embedModel string) (*IngestManifest, error) {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newIngestManifest(chunker, embedModel), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	var m IngestManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("decoding manifest %s: %w", path, err)
+	}
+	if m.Version != manifestVersion || m.Chunker != chunker || m.EmbedModel != embedModel {
+		return newIngestManifest(chunker, embedModel), nil
+	}
+	if m.Files == nil {
+		m.Files = map[string]*ManifestEntry{}
+	}
+	return &m, nil
+}
+
+// Save writes the manifest atomically (temp file + rename) so an interrupted
+// run never leaves a truncated manifest behind.
+func (m *IngestManifest) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating manifest directory: %w", err)
+	}
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".manifest-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Unchanged reports whether the file described by info still matches the
+// manifest entry for path. Size and mtime are checked first; only when they
+// differ is the content hashed, so a touched-but-identical file is not
+// re-embedded. The returned hash is empty when hashing was not needed.
+func (m *IngestManifest) Unchanged(path string, info os.FileInfo) (bool, string, error) {
+	e, ok := m.Files[path]
+	if ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+		return true, "", nil
+	}
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return false, "", err
+	}
+	if ok && e.SHA256 == sum {
+		// Content is identical; refresh the stat fields so the next run takes
+		// the fast path.
+		e.Size = info.Size()
+		e.ModTime = info.ModTime()
+		return true, sum, nil
+	}
+	return false, sum, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
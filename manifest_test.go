@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadIngestManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+	if m, err := loadIngestManifest(path, "tokens:a", "model"); err != nil || len(m.Files) != 0 {
+		t.Fatalf("missing manifest = %+v, %v; want empty", m, err)
+	}
+
+	saved := newIngestManifest("tokens:a", "model")
+	saved.Files["data/a.txt"] = &ManifestEntry{Path: "data/a.txt", SHA256: "abc", ChunkIDs: []string{"rag_1"}}
+	if err := saved.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name           string
+		version        int
+		chunker, model string
+		wantFiles      int
+	}{
+		{name: "same settings", version: manifestVersion, chunker: "tokens:a", model: "model", wantFiles: 1},
+		{name: "chunker changed", version: manifestVersion, chunker: "tokens:b", model: "model"},
+		{name: "model changed", version: manifestVersion, chunker: "tokens:a", model: "other"},
+		{name: "older version", version: manifestVersion - 1, chunker: "tokens:a", model: "model"},
+	}
+	for _, tc := range cases {
+		saved.Version = tc.version
+		if err := saved.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		m, err := loadIngestManifest(path, tc.chunker, tc.model)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(m.Files) != tc.wantFiles {
+			t.Fatalf("%s: %d files, want %d", tc.name, len(m.Files), tc.wantFiles)
+		}
+		if m.Version != manifestVersion || m.Chunker != tc.chunker || m.EmbedModel != tc.model {
+			t.Fatalf("%s: manifest settings = %d %q %q", tc.name, m.Version, m.Chunker, m.EmbedModel)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("{torn"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadIngestManifest(path, "tokens:a", "model"); err == nil {
+		t.Fatalf("corrupt manifest: expected error")
+	}
+}
+
+func TestManifestUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := info.ModTime().Add(time.Hour)
+
+	cases := []struct {
+		name      string
+		entry     *ManifestEntry // nil for a file not in the manifest
+		unchanged bool
+		hashed    bool
+	}{
+		{name: "new file", hashed: true},
+		// Matching size and mtime skip hashing, even if the hash is stale.
+		{name: "same stat", entry: &ManifestEntry{Size: 5, ModTime: info.ModTime(), SHA256: "stale"}, unchanged: true},
+		{name: "touched, same content", entry: &ManifestEntry{Size: 5, ModTime: later, SHA256: sum}, unchanged: true, hashed: true},
+		{name: "same size, new content", entry: &ManifestEntry{Size: 5, ModTime: later, SHA256: "old"}, hashed: true},
+		{name: "size changed", entry: &ManifestEntry{Size: 4, ModTime: info.ModTime(), SHA256: "old"}, hashed: true},
+	}
+	for _, tc := range cases {
+		m := newIngestManifest("c", "m")
+		if tc.entry != nil {
+			m.Files[path] = tc.entry
+		}
+		unchanged, got, err := m.Unchanged(path, info)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if unchanged != tc.unchanged || (got != "") != tc.hashed {
+			t.Fatalf("%s: Unchanged = %v, hash %q; want %v, hashed %v", tc.name, unchanged, got, tc.unchanged, tc.hashed)
+		}
+		if tc.hashed && got != sum {
+			t.Fatalf("%s: hash = %q, want %q", tc.name, got, sum)
+		}
+		// A touched file with identical content takes the fast path next time.
+		if tc.unchanged && tc.hashed && !m.Files[path].ModTime.Equal(info.ModTime()) {
+			t.Fatalf("%s: entry mtime not refreshed", tc.name)
+		}
+	}
+
+	if _, _, err := newIngestManifest("c", "m").Unchanged(filepath.Join(dir, "gone.txt"), info); err == nil {
+		t.Fatalf("missing file: expected error")
+	}
+}
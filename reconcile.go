@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// ReconcileReport describes chunks in rag_docs that no longer correspond to
+// a chunk of an ingested file.
+type ReconcileReport struct {
+	DryRun  bool
+	Orphans []string            // orphaned chunk IDs
+	Sources map[string][]string // source path -> orphaned chunk IDs
+	Deleted int
+}
+
+// reconcileRagDocs deletes document chunks whose source lies inside one of
+// roots but whose ID is not in live (the IDs produced by the current walk).
+// Chunks from sources outside the roots are left alone. With dryRun set
+// nothing is deleted and the report lists what would have been removed.
+func reconcileRagDocs(ctx context.Context, roots []string, live map[string]bool, dryRun bool) (*ReconcileReport, error) {
+	if ragDocsCollection == nil {
+		return nil, fmt.Errorf("ragDocsCollection not initialized")
+	}
+
+	report := &ReconcileReport{DryRun: dryRun, Sources: map[string][]string{}}
+	where := chroma.EqString("type", "document")
+	err := chromaForEach(ctx, ragDocsCollection, where, func(id, _ string, meta map[string]interface{}) error {
+		if live[id] {
+			return nil
+		}
+		source := fmt.Sprintf("%v", meta["source"])
+		if !withinAnyDir(roots, source) {
+			return nil
+		}
+		report.Orphans = append(report.Orphans, id)
+		report.Sources[source] = append(report.Sources[source], id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun || len(report.Orphans) == 0 {
+		return report, nil
+	}
+	if err := chromaDeleteIDs(ctx, ragDocsCollection, report.Orphans); err != nil {
+		return report, fmt.Errorf("deleting orphaned chunks: %w", err)
+	}
+	report.Deleted = len(report.Orphans)
+	return report, nil
+}
+
+// Log prints a short summary of the report; dry runs also list every source
+// that would lose chunks.
+func (r *ReconcileReport) Log() {
+	if r == nil || len(r.Orphans) == 0 {
+		return
+	}
+	if !r.DryRun {
+		log.Printf("Removed %d stale chunks from %d sources", r.Deleted, len(r.Sources))
+		return
+	}
+
+	log.Printf("Dry run: %d stale chunks from %d sources would be removed", len(r.Orphans), len(r.Sources))
+	sources := make([]string, 0, len(r.Sources))
+	for s := range r.Sources {
+		sources = append(sources, s)
+	}
+	sort.Strings(sources)
+	for _, s := range sources {
+		log.Printf("  %s: %d chunks", s, len(r.Sources[s]))
+	}
+}
+
+func withinAnyDir(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if withinDir(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinDir reports whether path is dir or lies below it. Relative paths are
+// resolved against the working directory first, so a relative RAG_DATA_DIR
+// still matches the sources of an earlier run that used an absolute one.
+func withinDir(dir, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithinDir(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		dir, path string
+		want      bool
+	}{
+		{"data", "data/a.txt", true},
+		{"data", "data/sub/a.txt", true},
+		{"data", "data", true},
+		{"./data/", "data/a.txt", true},
+		{"data", "data/../data/a.txt", true},
+		// A file whose name merely starts with "..".
+		{"data", "data/..notes.txt", true},
+		{"data", "data/../other/a.txt", false},
+		{"data", "../data/a.txt", false},
+		{"data", "other/a.txt", false},
+		// Siblings sharing a prefix are not inside.
+		{"data", "data2/a.txt", false},
+		{"/srv/data", "/srv/data2/a.txt", false},
+		{"/srv/data", "/srv/data/a.txt", true},
+		{"/srv/data", "/srv", false},
+		// Relative and absolute forms of the same path.
+		{"data", filepath.Join(cwd, "data", "a.txt"), true},
+		{filepath.Join(cwd, "data"), "data/a.txt", true},
+		{"data", filepath.Join(cwd, "data2", "a.txt"), false},
+		{"data", "/elsewhere/data/a.txt", false},
+	}
+	for _, tc := range cases {
+		if got := withinDir(tc.dir, filepath.FromSlash(tc.path)); got != tc.want {
+			t.Fatalf("withinDir(%q, %q) = %v, want %v", tc.dir, tc.path, got, tc.want)
+		}
+	}
+
+	if !withinAnyDir([]string{"docs", "data"}, "data/a.txt") || withinAnyDir([]string{"docs", "data"}, "data2/a.txt") || withinAnyDir(nil, "data/a.txt") {
+		t.Fatalf("withinAnyDir does not check each root")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const chatHelp = `Commands:
+  /history   print the conversation so far
+  /reset     forget the in-process conversation (stored memory is kept)
+  /sources   list the chunks retrieved for the last answer
+  /quit      exit`
+
+// runChat reads prompts from in until EOF or /quit, answering each with the
+// agent. Everything (Chroma, embedder, LLM, indexes) is initialized once by
+// the caller; each turn sees the previous ones through conversationLog.
+func runChat(ctx context.Context, session Session, in io.Reader, out io.Writer, stream bool, verbose bool) error {
+	fmt.Fprintf(out, "Chatting in session %q. Type /help for commands.\n", session.ID)
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lastTrace *runTrace
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		switch strings.ToLower(line) {
+		case "/quit", "/exit":
+			return nil
+		case "/help":
+			fmt.Fprintln(out, chatHelp)
+			continue
+		case "/history":
+			for _, m := range conversationLog {
+				fmt.Fprintln(out, formatChatMessage(m))
+			}
+			continue
+		case "/reset":
+			conversationLog = nil
+			lastTrace = nil
+			fmt.Fprintln(out, "Conversation reset.")
+			continue
+		case "/sources":
+			printSources(out, lastTrace.Sources())
+			continue
+		}
+		if strings.HasPrefix(line, "/") {
+			fmt.Fprintf(out, "Unknown command %s\n%s\n", line, chatHelp)
+			continue
+		}
+
+		opts := streamOptions{Verbose: verbose}
+		if stream {
+			opts.Out = out
+		}
+		response, trace, err := askAgent(ctx, session, line, opts)
+		lastTrace = trace
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(os.Stderr, "Agent execution failed: %v\n", err)
+			continue
+		}
+		if !stream {
+			fmt.Fprintln(out, response)
+		}
+	}
+}
+
+func printSources(out io.Writer, sources []Retrieved) {
+	if len(sources) == 0 {
+		fmt.Fprintln(out, "No sources were retrieved for the last answer.")
+		return
+	}
+	for i, r := range sources {
+		label := r.Source
+		if label == "" {
+			label = "conversation memory"
+		}
+		preview := strings.Join(strings.Fields(r.Text), " ")
+		if len(preview) > 80 {
+			preview = strings.ToValidUTF8(preview[:80], "") + "..."
+		}
+		fmt.Fprintf(out, "%d. %s [%s]\n   %s\n", i+1, label, r.ID, preview)
+	}
+}
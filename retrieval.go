@@ -1,12 +1,14 @@
 package main
 
 import (
+	"container/heap"
 	"context"
 	"fmt"
 	"math"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 
 	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
 )
@@ -16,91 +18,328 @@ type BM25Doc struct {
 	Text string
 }
 
+// posting records that a term occurs tf times in the document at index doc.
+type posting struct {
+	doc int
+	tf  int
+}
+
+// BM25Index is an inverted index: each term maps to the documents containing
+// it, so a query only touches documents that share at least one term with it.
+//
+// Documents live in numbered slots. Removing a document frees its slot for
+// reuse, so slots are not contiguous. The index is safe for concurrent use:
+// searches share a read lock while Add/Remove/Update take the write lock.
 type BM25Index struct {
-	docs      []BM25Doc
-	tf        []map[string]int
+	mu        sync.RWMutex
+	docs      []BM25Doc      // by slot; free slots have an empty ID
+	slots     map[string]int // doc ID -> slot
+	terms     [][]string     // distinct terms per slot, needed for removal
 	docLen    []int
-	df        map[string]int
+	postings  map[string][]posting
+	free      []int
+	totalLen  int
 	avgDocLen float64
 }
 
+const (
+	bm25K1 = 1.5
+	bm25B  = 0.75
+)
+
 func NewBM25Index(docs []BM25Doc) *BM25Index {
 	idx := &BM25Index{
-		docs:   docs,
-		tf:     make([]map[string]int, len(docs)),
-		docLen: make([]int, len(docs)),
-		df:     map[string]int{},
-	}
-	var totalLen int
-	for i, d := range docs {
-		tokens := tokenize(d.Text)
-		idx.docLen[i] = len(tokens)
-		totalLen += len(tokens)
-
-		tf := map[string]int{}
-		seen := map[string]bool{}
-		for _, tok := range tokens {
-			tf[tok]++
-			if !seen[tok] {
-				seen[tok] = true
-				idx.df[tok]++
+		docs:     make([]BM25Doc, 0, len(docs)),
+		slots:    make(map[string]int, len(docs)),
+		terms:    make([][]string, 0, len(docs)),
+		docLen:   make([]int, 0, len(docs)),
+		postings: map[string][]posting{},
+	}
+	for _, d := range docs {
+		idx.remove(d.ID)
+		idx.add(d)
+	}
+	idx.updateAvgDocLen()
+	return idx
+}
+
+// Len returns the number of documents in the index.
+func (idx *BM25Index) Len() int {
+	if idx == nil {
+		return 0
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.slots)
+}
+
+// Terms returns the number of distinct terms in the index.
+func (idx *BM25Index) Terms() int {
+	if idx == nil {
+		return 0
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.postings)
+}
+
+// Docs returns a snapshot of the indexed documents.
+func (idx *BM25Index) Docs() []BM25Doc {
+	if idx == nil {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	out := make([]BM25Doc, 0, len(idx.slots))
+	for _, d := range idx.docs {
+		if d.ID != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Add indexes docs. A document whose ID is already present replaces the old
+// version, so Add and Update behave the same.
+func (idx *BM25Index) Add(docs ...BM25Doc) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, d := range docs {
+		idx.remove(d.ID)
+		idx.add(d)
+	}
+	idx.updateAvgDocLen()
+}
+
+// Update replaces the indexed text of docs.
+func (idx *BM25Index) Update(docs ...BM25Doc) {
+	idx.Add(docs...)
+}
+
+// Remove drops the documents with the given IDs; unknown IDs are ignored.
+func (idx *BM25Index) Remove(ids ...string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, id := range ids {
+		idx.remove(id)
+	}
+	idx.updateAvgDocLen()
+}
+
+// add indexes d in a free slot. The caller holds the write lock and has
+// already removed any previous version of d.
+func (idx *BM25Index) add(d BM25Doc) {
+	if d.ID == "" {
+		return
+	}
+	tokens := tokenize(d.Text)
+	tf := map[string]int{}
+	for _, tok := range tokens {
+		tf[tok]++
+	}
+	terms := make([]string, 0, len(tf))
+	for tok := range tf {
+		terms = append(terms, tok)
+	}
+
+	var slot int
+	if n := len(idx.free); n > 0 {
+		slot = idx.free[n-1]
+		idx.free = idx.free[:n-1]
+		idx.docs[slot] = d
+		idx.terms[slot] = terms
+		idx.docLen[slot] = len(tokens)
+	} else {
+		slot = len(idx.docs)
+		idx.docs = append(idx.docs, d)
+		idx.terms = append(idx.terms, terms)
+		idx.docLen = append(idx.docLen, len(tokens))
+	}
+	idx.slots[d.ID] = slot
+	idx.totalLen += len(tokens)
+
+	for tok, n := range tf {
+		idx.postings[tok] = append(idx.postings[tok], posting{doc: slot, tf: n})
+	}
+}
+
+// remove unindexes the document with id. The caller holds the write lock.
+func (idx *BM25Index) remove(id string) {
+	slot, ok := idx.slots[id]
+	if !ok {
+		return
+	}
+	for _, tok := range idx.terms[slot] {
+		plist := idx.postings[tok]
+		for i, p := range plist {
+			if p.doc == slot {
+				plist[i] = plist[len(plist)-1]
+				plist = plist[:len(plist)-1]
+				break
 			}
 		}
-		idx.tf[i] = tf
+		if len(plist) == 0 {
+			delete(idx.postings, tok)
+		} else {
+			idx.postings[tok] = plist
+		}
 	}
-	if len(docs) > 0 {
-		idx.avgDocLen = float64(totalLen) / float64(len(docs))
+
+	idx.totalLen -= idx.docLen[slot]
+	idx.docs[slot] = BM25Doc{}
+	idx.terms[slot] = nil
+	idx.docLen[slot] = 0
+	idx.free = append(idx.free, slot)
+	delete(idx.slots, id)
+}
+
+func (idx *BM25Index) updateAvgDocLen() {
+	idx.avgDocLen = 0
+	if n := len(idx.slots); n > 0 {
+		idx.avgDocLen = float64(idx.totalLen) / float64(n)
 	}
-	return idx
+}
+
+type bm25Scored struct {
+	doc   int
+	score float64
+}
+
+// less orders hits by descending score, breaking ties by slot so results are
+// deterministic.
+func (a bm25Scored) less(b bm25Scored) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return a.doc < b.doc
+}
+
+// bm25Heap is a min-heap (worst hit on top) holding the current top k.
+type bm25Heap []bm25Scored
+
+func (h bm25Heap) Len() int            { return len(h) }
+func (h bm25Heap) Less(i, j int) bool  { return h[j].less(h[i]) }
+func (h bm25Heap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *bm25Heap) Push(x interface{}) { *h = append(*h, x.(bm25Scored)) }
+func (h *bm25Heap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
 }
 
 func (idx *BM25Index) Search(query string, k int) []string {
-	if idx == nil || len(idx.docs) == 0 {
+	if idx == nil {
 		return nil
 	}
-	qTokens := tokenize(query)
-	if len(qTokens) == 0 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	top := idx.topK(query, k)
+	out := make([]string, 0, len(top))
+	for _, s := range top {
+		out = append(out, idx.docs[s.doc].ID)
+	}
+	return out
+}
+
+// BM25Hit is one scored search result.
+type BM25Hit struct {
+	ID    string
+	Score float64
+	// MatchedTerms are the distinct query terms the document contains, in
+	// query order.
+	MatchedTerms []string
+}
+
+// SearchScored is Search with each hit's score and matched query terms.
+func (idx *BM25Index) SearchScored(query string, k int) []BM25Hit {
+	if idx == nil {
 		return nil
 	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 
-	type scored struct {
-		id    string
-		score float64
+	top := idx.topK(query, k)
+	if len(top) == 0 {
+		return nil
+	}
+	var qTerms []string
+	seen := map[string]bool{}
+	for _, t := range tokenize(query) {
+		if !seen[t] {
+			seen[t] = true
+			qTerms = append(qTerms, t)
+		}
 	}
 
-	N := float64(len(idx.docs))
-	k1 := 1.5
-	b := 0.75
+	out := make([]BM25Hit, 0, len(top))
+	for _, s := range top {
+		docTerms := make(map[string]bool, len(idx.terms[s.doc]))
+		for _, t := range idx.terms[s.doc] {
+			docTerms[t] = true
+		}
+		hit := BM25Hit{ID: idx.docs[s.doc].ID, Score: s.score}
+		for _, t := range qTerms {
+			if docTerms[t] {
+				hit.MatchedTerms = append(hit.MatchedTerms, t)
+			}
+		}
+		out = append(out, hit)
+	}
+	return out
+}
 
-	scores := make([]scored, 0, len(idx.docs))
-	for i, d := range idx.docs {
-		var score float64
-		dl := float64(idx.docLen[i])
-		tf := idx.tf[i]
+// topK scores every document that shares a term with query and returns the k
+// best, best first. The caller holds the read lock.
+func (idx *BM25Index) topK(query string, k int) []bm25Scored {
+	if len(idx.slots) == 0 || k <= 0 {
+		return nil
+	}
+	qTokens := tokenize(query)
+	if len(qTokens) == 0 {
+		return nil
+	}
 
-		for _, t := range qTokens {
-			f := float64(tf[t])
-			if f == 0 {
-				continue
-			}
-			df := float64(idx.df[t])
-			idf := math.Log(1.0 + (N-df+0.5)/(df+0.5))
+	N := float64(len(idx.slots))
 
-			den := f + k1*(1.0-b+b*(dl/idx.avgDocLen))
-			score += idf * (f * (k1 + 1.0) / den)
+	// Terms are applied in query order (duplicates included) so each
+	// document's score is summed exactly as the per-document scan did.
+	scores := map[int]float64{}
+	for _, t := range qTokens {
+		plist := idx.postings[t]
+		if len(plist) == 0 {
+			continue
 		}
-		if score > 0 {
-			scores = append(scores, scored{id: d.ID, score: score})
+		df := float64(len(plist))
+		idf := math.Log(1.0 + (N-df+0.5)/(df+0.5))
+
+		for _, p := range plist {
+			f := float64(p.tf)
+			dl := float64(idx.docLen[p.doc])
+			den := f + bm25K1*(1.0-bm25B+bm25B*(dl/idx.avgDocLen))
+			scores[p.doc] += idf * (f * (bm25K1 + 1.0) / den)
 		}
 	}
 
-	sort.Slice(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
-	if k > len(scores) {
-		k = len(scores)
+	h := make(bm25Heap, 0, k)
+	for doc, score := range scores {
+		if score <= 0 {
+			continue
+		}
+		s := bm25Scored{doc: doc, score: score}
+		if len(h) < k {
+			heap.Push(&h, s)
+		} else if s.less(h[0]) {
+			h[0] = s
+			heap.Fix(&h, 0)
+		}
 	}
-	out := make([]string, 0, k)
-	for i := 0; i < k; i++ {
-		out = append(out, scores[i].id)
+
+	out := make([]bm25Scored, len(h))
+	for i := len(h) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(&h).(bm25Scored)
 	}
 	return out
 }
@@ -114,28 +353,110 @@ func tokenize(s string) []string {
 	return parts
 }
 
+// Each collection has its own BM25 index, keyed by collection name, so
+// hybridRetrieve can be pointed at any collection.
+var (
+	lexicalMu      sync.Mutex
+	lexicalIndexes = map[string]*BM25Index{}
+)
+
+// lexicalIndex returns the BM25 index registered for c, registering an empty
+// one if there is none yet.
+func lexicalIndex(c chroma.Collection) *BM25Index {
+	lexicalMu.Lock()
+	defer lexicalMu.Unlock()
+	idx, ok := lexicalIndexes[c.Name()]
+	if !ok {
+		idx = NewBM25Index(nil)
+		lexicalIndexes[c.Name()] = idx
+	}
+	return idx
+}
+
+func setLexicalIndex(c chroma.Collection, idx *BM25Index) {
+	lexicalMu.Lock()
+	defer lexicalMu.Unlock()
+	lexicalIndexes[c.Name()] = idx
+}
+
 type Retrieved struct {
 	ID     string
 	Text   string
 	Source string
+	Meta   map[string]interface{}
+	Score  RetrievalScore
+}
+
+// RetrievalScore records how a result was ranked by each retriever. Ranks
+// are 1-based; a zero rank means that retriever did not return the result,
+// and its other fields are then zero too.
+type RetrievalScore struct {
+	BM25Rank       int      `json:"bm25_rank"`
+	BM25Score      float64  `json:"bm25_score"`
+	MatchedTerms   []string `json:"matched_terms,omitempty"`
+	VectorRank     int      `json:"vector_rank"`
+	VectorDistance float64  `json:"vector_distance"`
+	FusedScore     float64  `json:"rrf_score"`
 }
 
-func vectorRetrieve(ctx context.Context, c chroma.Collection, query string, k int) ([]Retrieved, error) {
+// merge copies the per-retriever fields that o has and s lacks.
+func (s *RetrievalScore) merge(o RetrievalScore) {
+	if s.BM25Rank == 0 && o.BM25Rank > 0 {
+		s.BM25Rank, s.BM25Score, s.MatchedTerms = o.BM25Rank, o.BM25Score, o.MatchedTerms
+	}
+	if s.VectorRank == 0 && o.VectorRank > 0 {
+		s.VectorRank, s.VectorDistance = o.VectorRank, o.VectorDistance
+	}
+}
+
+// metaFilter restricts retrieval to records whose metadata has every listed
+// key set to the given string value. A nil filter matches everything.
+type metaFilter map[string]string
+
+func (f metaFilter) where() chroma.WhereFilter {
+	if len(f) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	clauses := make([]chroma.WhereClause, 0, len(keys))
+	for _, k := range keys {
+		clauses = append(clauses, chroma.EqString(k, f[k]))
+	}
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+	return chroma.And(clauses...)
+}
+
+func (f metaFilter) matches(meta map[string]interface{}) bool {
+	for k, v := range f {
+		if s, ok := meta[k].(string); !ok || s != v {
+			return false
+		}
+	}
+	return true
+}
+
+func vectorRetrieve(ctx context.Context, c chroma.Collection, query string, k int, filter metaFilter) ([]Retrieved, error) {
 	if c == nil {
 		return nil, fmt.Errorf("collection is nil")
 	}
-	if hfEmbedder == nil {
+	if hfEmbedderConcrete == nil {
 		return nil, fmt.Errorf("HF embedder not initialized")
 	}
 
 	qID := stableID("q", query)
-	vecs, err := hfEmbedder.Embed(ctx, []Chunk{{ID: qID, Text: query}})
+	vecs, err := hfEmbedderConcrete.Embed(ctx, []Chunk{{ID: qID, Text: query}})
 	if err != nil {
 		return nil, err
 	}
 	qVec := vecs[qID]
 
-	ids, docs, metas, err := chromaQuery(ctx, c, qVec, k)
+	ids, docs, metas, dists, err := chromaQuery(ctx, c, qVec, k, filter.where())
 	if err != nil {
 		return nil, err
 	}
@@ -143,10 +464,15 @@ func vectorRetrieve(ctx context.Context, c chroma.Collection, query string, k in
 	out := make([]Retrieved, 0, len(ids))
 	for i := range ids {
 		r := Retrieved{ID: ids[i]}
+		r.Score.VectorRank = i + 1
+		if i < len(dists) {
+			r.Score.VectorDistance = dists[i]
+		}
 		if i < len(docs) {
 			r.Text = docs[i]
 		}
 		if i < len(metas) {
+			r.Meta = metas[i]
 			if s, ok := metas[i]["source"]; ok {
 				r.Source = fmt.Sprintf("%v", s)
 			}
@@ -156,73 +482,140 @@ func vectorRetrieve(ctx context.Context, c chroma.Collection, query string, k in
 	return out, nil
 }
 
-func hybridRetrieve(ctx context.Context, c chroma.Collection, query string, k int) ([]Retrieved, error) {
-	// Vector top-k
-	vecTop, err := vectorRetrieve(ctx, c, query, k)
-	if err != nil {
-		return nil, err
+// lexicalRetrieve returns the BM25 top-k from c's own index, fetched from
+// Chroma by ID. The index is not filter-aware, so when filtering it reads
+// further down the ranking, four times as far each round, until k hits
+// match or the candidates run out; a small session in a large memory pool
+// still gets its lexical hits.
+func lexicalRetrieve(ctx context.Context, c chroma.Collection, query string, k int, filter metaFilter) ([]Retrieved, error) {
+	if c == nil {
+		return nil, fmt.Errorf("collection is nil")
 	}
 
-	// Lexical top-k (BM25) by IDs, then fetch those docs from Chroma by ID
-	var lexIDs []string
-	if bm25Index != nil {
-		lexIDs = bm25Index.Search(query, k)
+	idx := lexicalIndex(c)
+	lexK := k
+	if len(filter) > 0 {
+		lexK = k * 5
+	}
+	out := make([]Retrieved, 0, k)
+	seen := map[string]bool{}
+	for {
+		hits := idx.SearchScored(query, lexK)
+		var fresh []BM25Hit
+		lexIDs := make([]string, 0, len(hits))
+		for _, h := range hits {
+			if !seen[h.ID] {
+				seen[h.ID] = true
+				fresh = append(fresh, h)
+				lexIDs = append(lexIDs, h.ID)
+			}
+		}
+
+		fetched, err := chromaGetByIDs(ctx, c, lexIDs)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[string]Retrieved, len(fetched))
+		for _, r := range fetched {
+			byID[r.ID] = r
+		}
+		for _, h := range fresh {
+			if r, ok := byID[h.ID]; ok && filter.matches(r.Meta) && len(out) < k {
+				r.Score.BM25Rank = len(out) + 1
+				r.Score.BM25Score = h.Score
+				r.Score.MatchedTerms = h.MatchedTerms
+				out = append(out, r)
+			}
+		}
+
+		if len(out) >= k || len(hits) < lexK || len(filter) == 0 {
+			return out, nil
+		}
+		lexK *= 4
 	}
+}
+
+// rrfK is the Reciprocal Rank Fusion constant: a result at rank r in one
+// list contributes 1/(rrfK+r) to its fused score.
+const rrfK = 60
 
-	lexTop, err := chromaGetByIDs(ctx, c, lexIDs)
+// hybridRetrieve fuses vector and BM25 results from c. With a filter, the
+// vector query is restricted server-side and BM25 hits are filtered on their
+// metadata after fetching.
+func hybridRetrieve(ctx context.Context, c chroma.Collection, query string, k int, filter metaFilter) ([]Retrieved, error) {
+	fused, err := hybridCandidates(ctx, c, query, k, filter)
 	if err != nil {
 		return nil, err
 	}
-
-	// RRF fuse
-	fusedIDs := rrfFuseIDs(lexIDs, idsFromRetrieved(vecTop), 60)
-	if k > len(fusedIDs) {
-		k = len(fusedIDs)
+	if k < len(fused) {
+		fused = fused[:k]
 	}
-	finalIDs := fusedIDs[:k]
+	return fused, nil
+}
 
-	// Build map of id->Retrieved from both sources
-	m := map[string]Retrieved{}
-	for _, r := range lexTop {
-		m[r.ID] = r
+// hybridCandidates returns every result of the BM25 and vector top-k,
+// ordered by fused score. hybridRetrieve keeps the first k; explain shows
+// them all.
+func hybridCandidates(ctx context.Context, c chroma.Collection, query string, k int, filter metaFilter) ([]Retrieved, error) {
+	if c == nil {
+		return nil, fmt.Errorf("collection is nil")
 	}
-	for _, r := range vecTop {
-		if _, ok := m[r.ID]; !ok {
-			m[r.ID] = r
-		}
+
+	// Vector top-k
+	vecTop, err := vectorRetrieve(ctx, c, query, k, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	out := make([]Retrieved, 0, len(finalIDs))
-	for _, id := range finalIDs {
-		if r, ok := m[id]; ok {
-			out = append(out, r)
-		}
+	// Lexical top-k (BM25)
+	lexTop, err := lexicalRetrieve(ctx, c, query, k, filter)
+	if err != nil {
+		return nil, err
 	}
-	return out, nil
+
+	return rrfFuse(lexTop, vecTop), nil
 }
 
-func idsFromRetrieved(rs []Retrieved) []string {
-	out := make([]string, 0, len(rs))
-	for _, r := range rs {
-		out = append(out, r.ID)
+// rrfFuse merges ranked lists with Reciprocal Rank Fusion, best first. A
+// result found by several retrievers keeps each one's score fields. Ties
+// keep the order results were first seen in, lists taken in argument order.
+func rrfFuse(lists ...[]Retrieved) []Retrieved {
+	var out []Retrieved
+	pos := map[string]int{}
+	for _, list := range lists {
+		for i, r := range list {
+			j, ok := pos[r.ID]
+			if !ok {
+				j = len(out)
+				pos[r.ID] = j
+				out = append(out, r)
+			} else {
+				out[j].Score.merge(r.Score)
+			}
+			out[j].Score.FusedScore += 1.0 / float64(rrfK+i+1)
+		}
 	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score.FusedScore > out[j].Score.FusedScore })
 	return out
 }
 
-func rrfFuseIDs(a, b []string, k int) []string {
-	score := map[string]float64{}
-	add := func(list []string) {
-		for i, id := range list {
-			score[id] += 1.0 / float64(k+i+1)
-		}
-	}
-	add(a)
-	add(b)
+// Retrieval modes, for debugging one side of hybrid retrieval on its own.
+const (
+	retrieveBM25   = "bm25"
+	retrieveVector = "vector"
+	retrieveHybrid = "hybrid"
+)
 
-	uniq := make([]string, 0, len(score))
-	for id := range score {
-		uniq = append(uniq, id)
+// retrieveWithMode runs BM25-only, vector-only or hybrid retrieval.
+func retrieveWithMode(ctx context.Context, mode string, c chroma.Collection, query string, k int, filter metaFilter) ([]Retrieved, error) {
+	switch mode {
+	case retrieveBM25:
+		return lexicalRetrieve(ctx, c, query, k, filter)
+	case retrieveVector:
+		return vectorRetrieve(ctx, c, query, k, filter)
+	case retrieveHybrid:
+		return hybridRetrieve(ctx, c, query, k, filter)
+	default:
+		return nil, fmt.Errorf("unknown retrieval mode %q (want %s, %s or %s)", mode, retrieveBM25, retrieveVector, retrieveHybrid)
 	}
-	sort.Slice(uniq, func(i, j int) bool { return score[uniq[i]] > score[uniq[j]] })
-	return uniq
-}
\ No newline at end of file
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// naiveBM25 is the original full-scan implementation, kept as a reference for
+// the inverted index: same k1/b, same idf, one pass over every document.
+type naiveBM25 struct {
+	docs      []BM25Doc
+	tf        []map[string]int
+	docLen    []int
+	df        map[string]int
+	avgDocLen float64
+}
+
+func newNaiveBM25(docs []BM25Doc) *naiveBM25 {
+	idx := &naiveBM25{
+		docs:   docs,
+		tf:     make([]map[string]int, len(docs)),
+		docLen: make([]int, len(docs)),
+		df:     map[string]int{},
+	}
+	var totalLen int
+	for i, d := range docs {
+		tokens := tokenize(d.Text)
+		idx.docLen[i] = len(tokens)
+		totalLen += len(tokens)
+
+		tf := map[string]int{}
+		seen := map[string]bool{}
+		for _, tok := range tokens {
+			tf[tok]++
+			if !seen[tok] {
+				seen[tok] = true
+				idx.df[tok]++
+			}
+		}
+		idx.tf[i] = tf
+	}
+	if len(docs) > 0 {
+		idx.avgDocLen = float64(totalLen) / float64(len(docs))
+	}
+	return idx
+}
+
+func (idx *naiveBM25) Search(query string, k int) ([]string, []float64) {
+	qTokens := tokenize(query)
+	if len(qTokens) == 0 {
+		return nil, nil
+	}
+
+	type scored struct {
+		id    string
+		score float64
+	}
+
+	N := float64(len(idx.docs))
+	k1 := 1.5
+	b := 0.75
+
+	scores := make([]scored, 0, len(idx.docs))
+	for i, d := range idx.docs {
+		var score float64
+		dl := float64(idx.docLen[i])
+		tf := idx.tf[i]
+
+		for _, t := range qTokens {
+			f := float64(tf[t])
+			if f == 0 {
+				continue
+			}
+			df := float64(idx.df[t])
+			idf := math.Log(1.0 + (N-df+0.5)/(df+0.5))
+
+			den := f + k1*(1.0-b+b*(dl/idx.avgDocLen))
+			score += idf * (f * (k1 + 1.0) / den)
+		}
+		if score > 0 {
+			scores = append(scores, scored{id: d.ID, score: score})
+		}
+	}
+
+	// Stable so ties keep corpus order, matching the inverted index.
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+	if k > len(scores) {
+		k = len(scores)
+	}
+	ids := make([]string, 0, k)
+	vals := make([]float64, 0, k)
+	for i := 0; i < k; i++ {
+		ids = append(ids, scores[i].id)
+		vals = append(vals, scores[i].score)
+	}
+	return ids, vals
+}
+
+// syntheticCorpus builds n documents from a Zipf-distributed vocabulary so
+// that common terms have long postings lists, like real text.
+func syntheticCorpus(n int, seed int64) []BM25Doc {
+	r := rand.New(rand.NewSource(seed))
+	zipf := rand.NewZipf(r, 1.2, 1, 20000)
+	docs := make([]BM25Doc, n)
+	var sb strings.Builder
+	for i := range docs {
+		sb.Reset()
+		words := 40 + r.Intn(120)
+		for w := 0; w < words; w++ {
+			fmt.Fprintf(&sb, "w%d ", zipf.Uint64())
+		}
+		docs[i] = BM25Doc{ID: fmt.Sprintf("doc-%d", i), Text: sb.String()}
+	}
+	return docs
+}
+
+var benchQueries = []string{
+	"w1 w17 w250",
+	"w3 w3 w4000",
+	"w12 w99 w512 w1024 w7",
+	"w19999",
+}
+
+func TestBM25SearchMatchesNaive(t *testing.T) {
+	docs := syntheticCorpus(2000, 1)
+	idx := NewBM25Index(docs)
+	ref := newNaiveBM25(docs)
+
+	for _, q := range append(benchQueries, "", "nothing-matches") {
+		for _, k := range []int{1, 5, 50} {
+			wantIDs, wantScores := ref.Search(q, k)
+			top := idx.topK(q, k)
+			if len(top) != len(wantIDs) {
+				t.Fatalf("query %q k=%d: got %d hits, want %d", q, k, len(top), len(wantIDs))
+			}
+			for i, s := range top {
+				if got := idx.docs[s.doc].ID; got != wantIDs[i] || s.score != wantScores[i] {
+					t.Fatalf("query %q k=%d hit %d: got %s (%v), want %s (%v)", q, k, i, got, s.score, wantIDs[i], wantScores[i])
+				}
+			}
+		}
+	}
+}
+
+func benchmarkSearch(b *testing.B, search func(q string, k int)) {
+	b.Helper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		search(benchQueries[i%len(benchQueries)], 10)
+	}
+}
+
+func BenchmarkBM25Search(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		docs := syntheticCorpus(n, 1)
+		idx := NewBM25Index(docs)
+		ref := newNaiveBM25(docs)
+
+		b.Run(fmt.Sprintf("inverted/%d", n), func(b *testing.B) {
+			benchmarkSearch(b, func(q string, k int) { idx.Search(q, k) })
+		})
+		b.Run(fmt.Sprintf("naive/%d", n), func(b *testing.B) {
+			benchmarkSearch(b, func(q string, k int) { ref.Search(q, k) })
+		})
+	}
+}
+
+func TestBM25IncrementalMatchesRebuild(t *testing.T) {
+	docs := syntheticCorpus(500, 2)
+	idx := NewBM25Index(docs[:300])
+
+	// Remove a third, add the rest, and rewrite a few documents in place.
+	var removed []string
+	for i := 0; i < 300; i += 3 {
+		removed = append(removed, docs[i].ID)
+	}
+	idx.Remove(removed...)
+	idx.Add(docs[300:]...)
+	updated := syntheticCorpus(10, 3)
+	for i := range updated {
+		updated[i].ID = docs[301+i].ID
+	}
+	idx.Update(updated...)
+
+	removedSet := map[string]bool{}
+	for _, id := range removed {
+		removedSet[id] = true
+	}
+	var want []BM25Doc
+	for _, d := range docs {
+		if !removedSet[d.ID] {
+			want = append(want, d)
+		}
+	}
+	for i, u := range updated {
+		for j := range want {
+			if want[j].ID == u.ID {
+				want[j] = updated[i]
+			}
+		}
+	}
+	ref := NewBM25Index(want)
+
+	if idx.Len() != ref.Len() {
+		t.Fatalf("Len() = %d, want %d", idx.Len(), ref.Len())
+	}
+	for _, q := range benchQueries {
+		got := idx.topK(q, 20)
+		exp := ref.topK(q, 20)
+		if len(got) != len(exp) {
+			t.Fatalf("query %q: got %d hits, want %d", q, len(got), len(exp))
+		}
+		for i := range got {
+			// Slots differ between the two indexes, so compare scores; IDs only
+			// have to agree where scores are not tied.
+			if math.Abs(got[i].score-exp[i].score) > 1e-9 {
+				t.Fatalf("query %q hit %d: score %v, want %v", q, i, got[i].score, exp[i].score)
+			}
+		}
+	}
+}
+
+func TestBM25SearchScoredMatchesTopK(t *testing.T) {
+	docs := syntheticCorpus(2000, 1)
+	idx := NewBM25Index(docs)
+	ref := newNaiveBM25(docs)
+
+	for _, q := range benchQueries {
+		wantIDs, wantScores := ref.Search(q, 10)
+		hits := idx.SearchScored(q, 10)
+		if len(hits) != len(wantIDs) {
+			t.Fatalf("query %q: got %d hits, want %d", q, len(hits), len(wantIDs))
+		}
+		qTerms := strings.Fields(q)
+		for i, h := range hits {
+			if h.ID != wantIDs[i] || h.Score != wantScores[i] {
+				t.Fatalf("query %q hit %d: got %s (%v), want %s (%v)", q, i, h.ID, h.Score, wantIDs[i], wantScores[i])
+			}
+			if len(h.MatchedTerms) == 0 {
+				t.Fatalf("query %q hit %d: no matched terms", q, i)
+			}
+			docTerms := map[string]bool{}
+			for _, tok := range tokenize(docs[idx.slots[h.ID]].Text) {
+				docTerms[tok] = true
+			}
+			for _, term := range h.MatchedTerms {
+				if !docTerms[term] || !containsString(qTerms, term) {
+					t.Fatalf("query %q hit %d: matched term %q is not in both query and document", q, i, term)
+				}
+			}
+		}
+	}
+}
+
+func TestRRFFuseKeepsPerRetrieverScores(t *testing.T) {
+	lex := []Retrieved{
+		{ID: "a", Score: RetrievalScore{BM25Rank: 1, BM25Score: 3.5, MatchedTerms: []string{"x"}}},
+		{ID: "b", Score: RetrievalScore{BM25Rank: 2, BM25Score: 1.2}},
+	}
+	vec := []Retrieved{
+		{ID: "b", Score: RetrievalScore{VectorRank: 1, VectorDistance: 0.1}},
+		{ID: "c", Score: RetrievalScore{VectorRank: 2, VectorDistance: 0.4}},
+	}
+
+	fused := rrfFuse(lex, vec)
+	var got []string
+	for _, r := range fused {
+		got = append(got, r.ID)
+	}
+	if strings.Join(got, ",") != "b,a,c" {
+		t.Fatalf("fused order = %v, want [b a c]", got)
+	}
+
+	b := fused[0].Score
+	if b.BM25Rank != 2 || b.BM25Score != 1.2 || b.VectorRank != 1 || b.VectorDistance != 0.1 {
+		t.Fatalf("b lost per-retriever scores: %+v", b)
+	}
+	if want := 1.0/float64(rrfK+2) + 1.0/float64(rrfK+1); math.Abs(b.FusedScore-want) > 1e-12 {
+		t.Fatalf("b fused score = %v, want %v", b.FusedScore, want)
+	}
+	if a := fused[1].Score; a.VectorRank != 0 || a.MatchedTerms[0] != "x" {
+		t.Fatalf("a scores = %+v", a)
+	}
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// maxRequestBody caps request bodies; ingest requests carry whole documents.
+const maxRequestBody = 32 << 20
+
+// serverShutdownTimeout is how long in-flight requests get to finish once
+// shutdown starts.
+const serverShutdownTimeout = 30 * time.Second
+
+// runServer serves the HTTP API on addr until ctx is cancelled, then shuts
+// down gracefully. Everything (Chroma, embedder, LLM, tools, indexes) must
+// already be initialized. Each request's context is passed to the agent, so
+// a client disconnecting cancels its run.
+func runServer(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", handleChatCompletions)
+	mux.HandleFunc("POST /v1/retrieve", handleRetrieve)
+	mux.HandleFunc("POST /v1/ingest", handleIngest)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("Serving on %s", addr)
+		errc <- srv.ListenAndServe()
+	}()
+	go func() {
+		tick := time.NewTicker(bm25FlushInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				flushBM25Indexes()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %s for in-flight requests", serverShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down server: %w", err)
+	}
+	return nil
+}
+
+// apiSession resolves the session an API request stores turns under and
+// retrieves memory from. A client that names no session gets one of its own,
+// "user:<id>", rather than sharing the CLI's default; a request with neither
+// a session nor a user is rejected.
+func apiSession(id, user string) (Session, error) {
+	s := Session{ID: strings.TrimSpace(id), UserID: strings.TrimSpace(user)}
+	if s.ID == "" {
+		if s.UserID == "" {
+			return s, errors.New("session or user is required")
+		}
+		s.ID = "user:" + s.UserID
+	}
+	return s, nil
+}
+
+// ------------------
+// Chat completions
+// ------------------
+
+// chatCompletionRequest is the OpenAI chat completions request, plus a
+// session extension field selecting the conversation session.
+type chatCompletionRequest struct {
+	Model    string           `json:"model"`
+	Messages []chatAPIMessage `json:"messages"`
+	Stream   bool             `json:"stream"`
+	User     string           `json:"user"`
+	Session  string           `json:"session"`
+}
+
+type chatAPIMessage struct {
+	Role    string         `json:"role"`
+	Content chatAPIContent `json:"content"`
+}
+
+// chatAPIContent accepts both forms of message content: a string, or an
+// array of parts of which the text parts are kept.
+type chatAPIContent string
+
+func (c *chatAPIContent) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = chatAPIContent(s)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return errors.New("content must be a string or an array of parts")
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	*c = chatAPIContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+type chatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []chatCompletionChoice `json:"choices"`
+	Session string                 `json:"session"`
+}
+
+type chatCompletionChoice struct {
+	Index        int             `json:"index"`
+	Message      *chatAPIMessage `json:"message,omitempty"`
+	Delta        *chatDelta      `json:"delta,omitempty"`
+	FinishReason *string         `json:"finish_reason"`
+}
+
+type chatDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// handleChatCompletions runs one agent turn. The last message must come from
+// the user; earlier user/assistant messages are the conversation history.
+// When the client sends no history, the session's stored turns are used.
+func handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatCompletionRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != "user" {
+		writeAPIError(w, http.StatusBadRequest, "messages must end with a user message")
+		return
+	}
+	prompt := strings.TrimSpace(string(req.Messages[len(req.Messages)-1].Content))
+	if prompt == "" {
+		writeAPIError(w, http.StatusBadRequest, "the last user message is empty")
+		return
+	}
+
+	session, err := apiSession(req.Session, req.User)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var history []llms.ChatMessage
+	for _, m := range req.Messages[:len(req.Messages)-1] {
+		switch m.Role {
+		case "user":
+			history = append(history, llms.HumanChatMessage{Content: string(m.Content)})
+		case "assistant":
+			history = append(history, llms.AIChatMessage{Content: string(m.Content)})
+		}
+	}
+	if len(history) == 0 {
+		turns, err := listConversationHistory(r.Context(), HistoryOptions{Session: session, Last: agentHistoryMessages / 2})
+		if err != nil {
+			log.Printf("Warning: Failed to load history for session %s: %v", session.ID, err)
+		}
+		for _, t := range turns {
+			history = append(history, turnMessages(t.Text)...)
+		}
+	}
+
+	resp := chatCompletionResponse{
+		ID:      "chatcmpl-" + randomID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   activeModelName(),
+		Session: session.ID,
+	}
+	if req.Stream {
+		streamChatCompletion(w, r, session, history, prompt, resp)
+		return
+	}
+
+	answer, _, _, err := runAgentTurn(r.Context(), session, history, prompt, streamOptions{})
+	if err != nil {
+		if r.Context().Err() != nil {
+			return // client went away
+		}
+		writeAPIError(w, http.StatusInternalServerError, "agent execution failed: "+err.Error())
+		return
+	}
+	stop := "stop"
+	resp.Choices = []chatCompletionChoice{{
+		Message:      &chatAPIMessage{Role: "assistant", Content: chatAPIContent(answer)},
+		FinishReason: &stop,
+	}}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// streamChatCompletion answers as server-sent chat.completion.chunk events,
+// streaming the final answer as the model generates it.
+func streamChatCompletion(w http.ResponseWriter, r *http.Request, session Session, history []llms.ChatMessage, prompt string, base chatCompletionResponse) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "streaming is not supported by this connection")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	sse := &sseChunkWriter{w: w, flusher: flusher, base: base}
+	sse.send(chatDelta{Role: "assistant"}, nil)
+
+	answer, streamed, _, err := runAgentTurn(r.Context(), session, history, prompt, streamOptions{Out: sse})
+	if err != nil {
+		if r.Context().Err() == nil {
+			sse.event(map[string]any{"error": map[string]string{"message": "agent execution failed: " + err.Error(), "type": "server_error"}})
+		}
+		return
+	}
+	if !streamed {
+		sse.send(chatDelta{Content: answer}, nil)
+	}
+	stop := "stop"
+	sse.send(chatDelta{}, &stop)
+	sse.done()
+}
+
+// sseChunkWriter turns writes into chat.completion.chunk events, so the
+// stream printer can write to it like a terminal.
+type sseChunkWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	base    chatCompletionResponse
+}
+
+func (s *sseChunkWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		s.send(chatDelta{Content: string(p)}, nil)
+	}
+	return len(p), nil
+}
+
+func (s *sseChunkWriter) send(delta chatDelta, finish *string) {
+	chunk := s.base
+	chunk.Object = "chat.completion.chunk"
+	chunk.Choices = []chatCompletionChoice{{Delta: &delta, FinishReason: finish}}
+	s.event(chunk)
+}
+
+func (s *sseChunkWriter) event(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "data: %s\n\n", data)
+	s.flusher.Flush()
+}
+
+func (s *sseChunkWriter) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprint(s.w, "data: [DONE]\n\n")
+	s.flusher.Flush()
+}
+
+// ------------------
+// Retrieval
+// ------------------
+
+type retrieveRequest struct {
+	Query       string `json:"query"`
+	K           int    `json:"k"`
+	Collection  string `json:"collection"` // "docs" (default), "memory" or "all"
+	Session     string `json:"session"`
+	User        string `json:"user"`
+	AllSessions bool   `json:"all_sessions"`
+}
+
+type retrieveResult struct {
+	ID         string                 `json:"id"`
+	Collection string                 `json:"collection"`
+	Source     string                 `json:"source,omitempty"`
+	Text       string                 `json:"text"`
+	Meta       map[string]interface{} `json:"metadata,omitempty"`
+	Score      RetrievalScore         `json:"score"`
+}
+
+// handleRetrieve runs hybrid retrieval without the agent, for debugging and
+// for apps that do their own generation.
+func handleRetrieve(w http.ResponseWriter, r *http.Request) {
+	var req retrieveRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeAPIError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+	if req.K <= 0 {
+		req.K = 5
+	}
+	if req.Collection == "" {
+		req.Collection = "docs"
+	}
+
+	results := []retrieveResult{}
+	add := func(name string, rs []Retrieved) {
+		for _, x := range rs {
+			results = append(results, retrieveResult{ID: x.ID, Collection: name, Source: x.Source, Text: x.Text, Meta: x.Meta, Score: x.Score})
+		}
+	}
+	switch req.Collection {
+	case "docs", "memory", "all":
+	default:
+		writeAPIError(w, http.StatusBadRequest, `collection must be "docs", "memory" or "all"`)
+		return
+	}
+	var session Session
+	if req.Collection != "docs" {
+		var err error
+		if session, err = apiSession(req.Session, req.User); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		session.CrossSession = req.AllSessions
+	}
+	if req.Collection != "memory" {
+		rs, err := hybridRetrieve(r.Context(), ragDocsCollection, req.Query, req.K, nil)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "retrieval failed: "+err.Error())
+			return
+		}
+		add("docs", rs)
+	}
+	if req.Collection != "docs" {
+		rs, err := hybridRetrieve(r.Context(), conversationCollection, req.Query, req.K, session.memoryFilter())
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "retrieval failed: "+err.Error())
+			return
+		}
+		add("memory", rs)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+// ------------------
+// Ingestion
+// ------------------
+
+type ingestRequest struct {
+	Documents []struct {
+		Source string `json:"source"`
+		Text   string `json:"text"`
+	} `json:"documents"`
+}
+
+type ingestResult struct {
+	Source   string   `json:"source"`
+	ChunkIDs []string `json:"chunk_ids"`
+	Removed  int      `json:"removed"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// ingestMu serializes API ingestion, so two requests for the same source
+// cannot interleave their upserts and stale-chunk removal.
+var ingestMu sync.Mutex
+
+// handleIngest indexes documents into rag_docs and its BM25 index. Each
+// document replaces any chunks previously stored for the same source; chunk
+// IDs use the same scheme as RAG_DATA_DIR ingestion.
+func handleIngest(w http.ResponseWriter, r *http.Request) {
+	var req ingestRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if len(req.Documents) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "documents is required")
+		return
+	}
+	for i, d := range req.Documents {
+		if strings.TrimSpace(d.Source) == "" || strings.TrimSpace(d.Text) == "" {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("documents[%d]: source and text are required", i))
+			return
+		}
+	}
+
+	if ragChunker == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, fmt.Sprintf("ingestion is unavailable: %v", ragChunkerErr))
+		return
+	}
+
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+
+	lexical := lexicalIndex(ragDocsCollection)
+	results := make([]ingestResult, 0, len(req.Documents))
+	changed := false
+	for _, d := range req.Documents {
+		res := ingestResult{Source: d.Source, ChunkIDs: []string{}}
+		chunks := chunkDocument(textDocument("text", d.Text), ragChunker)
+		ids, failed, err := indexChunks(r.Context(), d.Source, chunks)
+		res.ChunkIDs = append(res.ChunkIDs, ids...)
+		changed = changed || len(ids) > 0
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+		case failed:
+			res.Error = "some chunks could not be stored"
+		default:
+			// Drop chunks left over from a longer earlier version.
+			stale, err := staleSourceChunks(r.Context(), d.Source, ids)
+			if err == nil && len(stale) > 0 {
+				err = chromaDeleteIDs(r.Context(), ragDocsCollection, stale)
+			}
+			if err != nil {
+				res.Error = "removing old chunks: " + err.Error()
+			} else if len(stale) > 0 {
+				lexical.Remove(stale...)
+				res.Removed = len(stale)
+				changed = true
+			}
+		}
+		results = append(results, res)
+	}
+	if changed {
+		markBM25Dirty(ragDocsCollection)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"documents": results})
+}
+
+// staleSourceChunks returns the rag_docs IDs stored for source that are not
+// in keep.
+func staleSourceChunks(ctx context.Context, source string, keep []string) ([]string, error) {
+	keepSet := make(map[string]bool, len(keep))
+	for _, id := range keep {
+		keepSet[id] = true
+	}
+	var stale []string
+	err := chromaForEach(ctx, ragDocsCollection, metaFilter{"source": source}.where(), func(id, _ string, _ map[string]interface{}) error {
+		if !keepSet[id] {
+			stale = append(stale, id)
+		}
+		return nil
+	})
+	return stale, err
+}
+
+// ------------------
+// Helpers
+// ------------------
+
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	if err := dec.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: writing response: %v", err)
+	}
+}
+
+// writeAPIError writes an OpenAI-style error body.
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	typ := "invalid_request_error"
+	if status >= 500 {
+		typ = "server_error"
+	}
+	writeJSON(w, status, map[string]any{"error": map[string]string{"message": msg, "type": typ}})
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// activeModelName is the model reported in API responses.
+func activeModelName() string {
+	if currentConfig.LLMBackend == backendGemini {
+		return currentConfig.GeminiModel
+	}
+	return currentConfig.OpenRouterModel
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const defaultSessionID = "default"
+
+// Session identifies the conversation thread turns are stored under. Memory
+// retrieval and history are scoped to the session and user together, since
+// session names are chosen by clients and two users may pick the same one.
+type Session struct {
+	ID     string
+	UserID string
+	// CrossSession opts memory retrieval into searching every session of
+	// the user.
+	CrossSession bool
+}
+
+// memoryFilter restricts conversation_memory to the user's turns in the
+// session, or to all of the user's turns when CrossSession is set. Turns
+// stored before sessions existed carry neither tag and are not matched.
+func (s Session) memoryFilter() metaFilter {
+	f := metaFilter{"user": s.UserID}
+	if !s.CrossSession {
+		f["session"] = s.ID
+	}
+	return f
+}
+
+// SessionSummary describes one session in conversation_memory.
+type SessionSummary struct {
+	ID           string    `json:"session"`
+	UserID       string    `json:"user"`
+	Turns        int       `json:"turns"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// listSessions groups every stored turn by session and user, most recently
+// active first.
+func listSessions(ctx context.Context) ([]SessionSummary, error) {
+	if conversationCollection == nil {
+		return []SessionSummary{}, nil
+	}
+
+	type key struct{ session, user string }
+	byID := map[key]*SessionSummary{}
+	err := chromaForEach(ctx, conversationCollection, nil, func(_, _ string, meta map[string]interface{}) error {
+		var k key
+		k.session, _ = meta["session"].(string)
+		k.user, _ = meta["user"].(string)
+		s, ok := byID[k]
+		if !ok {
+			s = &SessionSummary{ID: k.session, UserID: k.user}
+			byID[k] = s
+		}
+		s.Turns++
+		if ts := parseTurnTimestamp(meta["timestamp"]); ts.After(s.LastActivity) {
+			s.LastActivity = ts
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]SessionSummary, 0, len(byID))
+	for _, s := range byID {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastActivity.Equal(out[j].LastActivity) {
+			return out[i].LastActivity.After(out[j].LastActivity)
+		}
+		if out[i].ID != out[j].ID {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].UserID < out[j].UserID
+	})
+	return out, nil
+}
+
+func printSessions(sessions []SessionSummary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tUSER\tTURNS\tLAST ACTIVITY")
+	for _, s := range sessions {
+		id := s.ID
+		if id == "" {
+			id = "(untagged)"
+		}
+		last := "-"
+		if !s.LastActivity.IsZero() {
+			last = s.LastActivity.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", id, s.UserID, s.Turns, last)
+	}
+	w.Flush()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSessionMemoryFilter(t *testing.T) {
+	cases := []struct {
+		session Session
+		want    string
+	}{
+		{Session{ID: "trip", UserID: "ada"}, "map[session:trip user:ada]"},
+		{Session{ID: "trip"}, "map[session:trip user:]"},
+		// Cross-session search still only covers the user's own turns.
+		{Session{ID: "trip", UserID: "ada", CrossSession: true}, "map[user:ada]"},
+	}
+	for _, tc := range cases {
+		if got := fmt.Sprint(tc.session.memoryFilter()); got != tc.want {
+			t.Fatalf("%+v: memoryFilter = %s, want %s", tc.session, got, tc.want)
+		}
+	}
+
+	// Two users sharing a session name do not match each other's turns.
+	ada := Session{ID: "trip", UserID: "ada"}.memoryFilter()
+	if ada.matches(map[string]interface{}{"session": "trip", "user": "bob"}) || !ada.matches(map[string]interface{}{"session": "trip", "user": "ada"}) {
+		t.Fatalf("memory filter does not separate users")
+	}
+	if ada.matches(map[string]interface{}{"type": "conversation"}) {
+		t.Fatalf("untagged turn matched %v", ada)
+	}
+}
+
+func TestAPISession(t *testing.T) {
+	cases := []struct {
+		session, user string
+		want          Session
+		ok            bool
+	}{
+		{"trip", "ada", Session{ID: "trip", UserID: "ada"}, true},
+		{"trip", "", Session{ID: "trip"}, true},
+		{"", "ada", Session{ID: "user:ada", UserID: "ada"}, true},
+		{" ", " ada ", Session{ID: "user:ada", UserID: "ada"}, true},
+		{"", "", Session{}, false},
+	}
+	for _, tc := range cases {
+		got, err := apiSession(tc.session, tc.user)
+		if (err == nil) != tc.ok || (tc.ok && got != tc.want) {
+			t.Fatalf("apiSession(%q, %q) = %+v, %v; want %+v, ok %v", tc.session, tc.user, got, err, tc.want, tc.ok)
+		}
+	}
+}
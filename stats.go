@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// StoreStats summarizes what the vector store, the BM25 indexes and the
+// ingestion manifest hold.
+type StoreStats struct {
+	Documents CollectionStats `json:"rag_docs"`
+	Memory    CollectionStats `json:"conversation_memory"`
+	Sources   int             `json:"sources"`
+	Sessions  int             `json:"sessions"`
+	Manifest  ManifestStats   `json:"manifest"`
+}
+
+// CollectionStats compares a Chroma collection with its BM25 index; the two
+// counts differ when the index is stale.
+type CollectionStats struct {
+	Name      string `json:"name"`
+	Records   int    `json:"records"`
+	BM25Docs  int    `json:"bm25_docs"`
+	BM25Terms int    `json:"bm25_terms"`
+}
+
+// ManifestStats describes the ingestion manifest as stored on disk.
+type ManifestStats struct {
+	Path       string `json:"path"`
+	Files      int    `json:"files"`
+	Chunker    string `json:"chunker,omitempty"`
+	EmbedModel string `json:"embed_model,omitempty"`
+}
+
+// collectStats counts records in both collections, distinct document
+// sources and sessions, and reads the manifest without validating it.
+func collectStats(ctx context.Context) (*StoreStats, error) {
+	stats := &StoreStats{}
+	var err error
+	if stats.Documents, err = collectionStats(ctx, ragDocsCollection); err != nil {
+		return nil, err
+	}
+	if stats.Memory, err = collectionStats(ctx, conversationCollection); err != nil {
+		return nil, err
+	}
+
+	sources := map[string]bool{}
+	err = chromaForEach(ctx, ragDocsCollection, nil, func(_, _ string, meta map[string]interface{}) error {
+		if s, ok := meta["source"].(string); ok {
+			sources[s] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing document sources: %w", err)
+	}
+	stats.Sources = len(sources)
+
+	sessions, err := listSessions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	stats.Sessions = len(sessions)
+
+	stats.Manifest.Path = manifestPath()
+	raw, err := os.ReadFile(stats.Manifest.Path)
+	switch {
+	case err == nil:
+		var m IngestManifest
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, fmt.Errorf("decoding manifest %s: %w", stats.Manifest.Path, err)
+		}
+		stats.Manifest.Files = len(m.Files)
+		stats.Manifest.Chunker = m.Chunker
+		stats.Manifest.EmbedModel = m.EmbedModel
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	return stats, nil
+}
+
+func collectionStats(ctx context.Context, c chroma.Collection) (CollectionStats, error) {
+	if c == nil {
+		return CollectionStats{}, fmt.Errorf("collection is nil")
+	}
+	n, err := c.Count(ctx)
+	if err != nil {
+		return CollectionStats{}, fmt.Errorf("counting %s: %w", c.Name(), err)
+	}
+	idx := lexicalIndex(c)
+	return CollectionStats{Name: c.Name(), Records: n, BM25Docs: idx.Len(), BM25Terms: idx.Terms()}, nil
+}
+
+func printStats(out io.Writer, s *StoreStats) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%d chunks from %d sources\tBM25: %d docs, %d terms\n", s.Documents.Name, s.Documents.Records, s.Sources, s.Documents.BM25Docs, s.Documents.BM25Terms)
+	fmt.Fprintf(w, "%s\t%d turns in %d sessions\tBM25: %d docs, %d terms\n", s.Memory.Name, s.Memory.Records, s.Sessions, s.Memory.BM25Docs, s.Memory.BM25Terms)
+	if s.Manifest.Files > 0 {
+		fmt.Fprintf(w, "manifest\t%d files\tchunker %s, %s (%s)\n", s.Manifest.Files, s.Manifest.Chunker, s.Manifest.EmbedModel, s.Manifest.Path)
+	} else {
+		fmt.Fprintf(w, "manifest\tno files ingested yet\t(%s)\n", s.Manifest.Path)
+	}
+	w.Flush()
+}
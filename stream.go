@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/callbacks"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	finalAnswerKeyword = "Final Answer:"
+	ansiDim            = "\x1b[2m"
+	ansiReset          = "\x1b[0m"
+)
+
+// streamOptions controls how an agent run is shown while it happens.
+type streamOptions struct {
+	// Out receives the final answer token by token; nil disables streaming.
+	Out io.Writer
+	// Verbose also shows the intermediate Thought/Action steps, dimmed.
+	Verbose bool
+}
+
+// streamPrinter is a langchaingo callbacks handler that writes the agent's
+// final answer to out as the LLM streams it. Every ReAct step is a separate
+// generation; text before "Final Answer:" is reasoning and is only shown
+// (dimmed) in verbose mode.
+type streamPrinter struct {
+	callbacks.SimpleHandler
+
+	out     io.Writer
+	verbose bool
+
+	mu       sync.Mutex
+	gen      strings.Builder // text of the current generation
+	printed  int             // bytes of gen already handled
+	inFinal  bool            // current generation has reached the final answer
+	streamed bool            // some final-answer text was written
+}
+
+var _ callbacks.Handler = (*streamPrinter)(nil)
+
+func newStreamPrinter(opts streamOptions) *streamPrinter {
+	return &streamPrinter{out: opts.Out, verbose: opts.Verbose}
+}
+
+func (p *streamPrinter) HandleLLMGenerateContentStart(_ context.Context, _ []llms.MessageContent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.verbose && p.gen.Len() > 0 && !p.inFinal {
+		fmt.Fprintln(p.out)
+	}
+	p.gen.Reset()
+	p.printed = 0
+	p.inFinal = false
+}
+
+func (p *streamPrinter) HandleStreamingFunc(_ context.Context, chunk []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gen.Write(chunk)
+	text := p.gen.String()
+
+	if !p.inFinal {
+		i := strings.Index(text, finalAnswerKeyword)
+		if i < 0 {
+			// The keyword may still be arriving across chunks, so hold back
+			// anything that could be its beginning.
+			safe := len(text) - len(finalAnswerKeyword)
+			if p.verbose && safe > p.printed {
+				fmt.Fprint(p.out, ansiDim+text[p.printed:safe]+ansiReset)
+				p.printed = safe
+			}
+			return
+		}
+		end := i + len(finalAnswerKeyword)
+		if p.verbose && end > p.printed {
+			fmt.Fprint(p.out, ansiDim+text[p.printed:end]+ansiReset+"\n")
+		}
+		p.inFinal = true
+		p.printed = end
+	}
+
+	rest := text[p.printed:]
+	if !p.streamed {
+		rest = strings.TrimLeft(rest, " \t\n")
+		if rest == "" {
+			return
+		}
+	}
+	fmt.Fprint(p.out, rest)
+	p.printed = len(text)
+	p.streamed = true
+}
+
+// Streamed reports whether any part of a final answer was written.
+func (p *streamPrinter) Streamed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.streamed
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Tokenizer counts tokens the way the embedding model will, so chunks can be
+// sized to fit its maximum sequence length.
+type Tokenizer interface {
+	Count(text string) int
+	// Name identifies the tokenizer in the chunking signature.
+	Name() string
+}
+
+const (
+	tokenizerWordPiece = "wordpiece"
+	tokenizerTiktoken  = "tiktoken"
+	tokenizerEstimate  = "estimate"
+)
+
+// defaultMaxSeqLength is assumed when the model publishes no limit of its
+// own. It is the limit of the default all-MiniLM-L6-v2; erring low only
+// makes chunks smaller.
+const defaultMaxSeqLength = 256
+
+// newTokenizer builds the CHUNK_TOKENIZER tokenizer for model. WordPiece
+// needs the model's vocab.txt and tiktoken its BPE ranks, both downloaded
+// once. When they cannot be loaded it fails rather than fall back to the
+// estimate: the tokenizer is part of the chunking signature, so switching
+// would re-chunk and re-embed the whole corpus.
+func newTokenizer(ctx context.Context, kind, model string) (Tokenizer, error) {
+	switch kind {
+	case tokenizerEstimate:
+		return estimateTokenizer{}, nil
+	case tokenizerTiktoken:
+		enc, err := tiktoken.GetEncoding("cl100k_base")
+		if err != nil {
+			return nil, fmt.Errorf("loading the tiktoken encoding: %w", err)
+		}
+		return tiktokenTokenizer{enc: enc}, nil
+	default:
+		if kind != tokenizerWordPiece {
+			log.Printf("Warning: Unknown CHUNK_TOKENIZER %q, using %s", kind, tokenizerWordPiece)
+		}
+		path, err := hubFile(ctx, model, "vocab.txt")
+		if err != nil {
+			return nil, fmt.Errorf("loading the %s vocabulary: %w", model, err)
+		}
+		tok, err := loadWordPiece(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading the %s vocabulary: %w", model, err)
+		}
+		return tok, nil
+	}
+}
+
+// modelMaxSeqLength reads max_seq_length from the model's
+// sentence_bert_config.json. A model without the file or the setting gets
+// defaultMaxSeqLength; a file that cannot be fetched is an error, for the
+// same reason as in newTokenizer.
+func modelMaxSeqLength(ctx context.Context, model string) (int, error) {
+	path, err := hubFile(ctx, model, "sentence_bert_config.json")
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s has no sentence_bert_config.json, assuming a maximum sequence length of %d", model, defaultMaxSeqLength)
+		return defaultMaxSeqLength, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading the maximum sequence length of %s: %w", model, err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var cfg struct {
+		MaxSeqLength int `json:"max_seq_length"`
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return 0, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	if cfg.MaxSeqLength <= 0 {
+		return defaultMaxSeqLength, nil
+	}
+	return cfg.MaxSeqLength, nil
+}
+
+// hubFile returns the local copy of a file from the model's Hugging Face Hub
+// repository, downloading it into RAG_STATE_DIR/hub on first use. A file the
+// repository does not have is reported as os.ErrNotExist.
+func hubFile(ctx context.Context, model, name string) (string, error) {
+	path := filepath.Join(currentConfig.StateDir, "hub", filepath.FromSlash(model), name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	url := fmt.Sprintf("https://huggingface.co/%s/resolve/main/%s", model, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if currentConfig.HFAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+currentConfig.HFAPIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("downloading %s: %w", url, os.ErrNotExist)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+name+"-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("downloading %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// ------------------
+// WordPiece
+// ------------------
+
+// wordPieceTokenizer reproduces the BERT tokenizer used by the
+// sentence-transformers models: split on whitespace and punctuation, then
+// greedy longest-match against the vocabulary, with "##" marking
+// word-internal pieces. Counts leave out [CLS] and [SEP].
+type wordPieceTokenizer struct {
+	vocab     map[string]bool
+	lowercase bool
+}
+
+// maxWordPieceRunes is the longest word WordPiece splits; longer ones are a
+// single [UNK].
+const maxWordPieceRunes = 100
+
+func loadWordPiece(path string) (*wordPieceTokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &wordPieceTokenizer{vocab: map[string]bool{}, lowercase: true}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		tok := strings.TrimRight(sc.Text(), "\r")
+		t.vocab[tok] = true
+		// Uncased vocabularies have no capitalized words.
+		if r, _ := utf8.DecodeRuneInString(tok); unicode.IsUpper(r) && !strings.HasPrefix(tok, "[") {
+			t.lowercase = false
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.vocab) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return t, nil
+}
+
+func (t *wordPieceTokenizer) Name() string { return tokenizerWordPiece }
+
+func (t *wordPieceTokenizer) Count(text string) int {
+	if t.lowercase {
+		text = strings.ToLower(text)
+	}
+	n := 0
+	for _, word := range basicTokens(text) {
+		n += t.pieces(word)
+	}
+	return n
+}
+
+// pieces is the number of WordPiece tokens word splits into.
+func (t *wordPieceTokenizer) pieces(word string) int {
+	runes := []rune(word)
+	if len(runes) > maxWordPieceRunes {
+		return 1
+	}
+	n := 0
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		for ; end > start; end-- {
+			piece := string(runes[start:end])
+			if start > 0 {
+				piece = "##" + piece
+			}
+			if t.vocab[piece] {
+				break
+			}
+		}
+		if end == start {
+			return 1 // the whole word becomes [UNK]
+		}
+		n++
+		start = end
+	}
+	return n
+}
+
+// basicTokens splits text on whitespace and around punctuation and CJK
+// characters, which always stand alone.
+func basicTokens(text string) []string {
+	var out []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			out = append(out, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r) || unicode.IsControl(r) || r == utf8.RuneError:
+			flush()
+		case isBertPunct(r) || unicode.Is(unicode.Han, r):
+			flush()
+			out = append(out, string(r))
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return out
+}
+
+// isBertPunct matches BERT's notion of punctuation: Unicode punctuation plus
+// every non-alphanumeric ASCII symbol.
+func isBertPunct(r rune) bool {
+	if (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+// ------------------
+// tiktoken
+// ------------------
+
+// tiktokenTokenizer counts cl100k_base tokens. It is not the tokenizer of
+// the sentence-transformers models, but is close for English text.
+type tiktokenTokenizer struct {
+	enc *tiktoken.Tiktoken
+}
+
+func (t tiktokenTokenizer) Name() string { return tokenizerTiktoken }
+
+func (t tiktokenTokenizer) Count(text string) int {
+	return len(t.enc.EncodeOrdinary(text))
+}
+
+// ------------------
+// Estimate
+// ------------------
+
+// estimateTokenizer approximates WordPiece without a vocabulary: one token
+// per punctuation mark and per six characters of a word. For ordinary prose
+// that errs on the high side, so chunks still fit.
+type estimateTokenizer struct{}
+
+func (estimateTokenizer) Name() string { return tokenizerEstimate }
+
+func (estimateTokenizer) Count(text string) int {
+	n := 0
+	for _, w := range basicTokens(text) {
+		n += (utf8.RuneCountInString(w) + 5) / 6
+	}
+	return n
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/tools"
+	"google.golang.org/genai"
+)
+
+// toolDef is a tool declared once: a name, a description and a handler taking
+// a typed input struct. Its schema is derived from the struct's fields:
+//
+//   - the json tag names the field; fields without omitempty are required
+//   - desc:"..." describes the field to the model
+//   - enum:"a,b,c" restricts a string field to the listed values
+type toolDef struct {
+	name        string
+	description string
+	schema      *genai.Schema
+	fields      []string // top-level fields in declaration order
+	invoke      func(ctx context.Context, session Session, args []byte) (any, error)
+}
+
+// defineTool declares a tool whose input is decoded into In. It panics if In
+// cannot be described by a schema, since tools are declared at init time.
+func defineTool[In any](name, description string, handler func(ctx context.Context, session Session, in In) (any, error)) *toolDef {
+	t := reflect.TypeFor[In]()
+	schema, err := schemaFor(t)
+	if err != nil {
+		panic(fmt.Sprintf("tool %s: %v", name, err))
+	}
+	if schema.Type != genai.TypeObject {
+		panic(fmt.Sprintf("tool %s: input must be a struct, got %s", name, t))
+	}
+
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, ok := jsonField(t.Field(i)); ok {
+			fields = append(fields, name)
+		}
+	}
+
+	return &toolDef{
+		name:        name,
+		description: description,
+		schema:      schema,
+		fields:      fields,
+		invoke: func(ctx context.Context, session Session, args []byte) (any, error) {
+			var in In
+			if err := json.Unmarshal(args, &in); err != nil {
+				return nil, err
+			}
+			return handler(ctx, session, in)
+		},
+	}
+}
+
+// run validates input against the tool's schema and calls the handler.
+// Invalid input and handler failures come back as an "Error: ..."
+// observation rather than a Go error, so the model sees what to fix and the
+// agent run carries on.
+func (d *toolDef) run(ctx context.Context, session Session, input string) string {
+	traceFrom(ctx).addToolCall(d.name)
+	args, err := d.parseInput(input)
+	if err == nil {
+		err = validateValue(d.schema, args, "")
+	}
+	if err != nil {
+		return fmt.Sprintf("Error: invalid input for %s: %v. %s", d.name, err, d.inputHint())
+	}
+
+	raw, _ := json.Marshal(args)
+	out, err := d.invoke(ctx, session, raw)
+	if err != nil {
+		return fmt.Sprintf("Error: %s failed: %v", d.name, err)
+	}
+	if s, ok := out.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return fmt.Sprintf("Error: %s returned unencodable output: %v", d.name, err)
+	}
+	return string(b)
+}
+
+// parseInput decodes a JSON object. Tools with a single required string
+// field also accept the bare value, as ReAct models often send it that way.
+func (d *toolDef) parseInput(input string) (map[string]any, error) {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "{") {
+		var args map[string]any
+		if err := json.Unmarshal([]byte(input), &args); err != nil {
+			return nil, fmt.Errorf("input is not valid JSON: %w", err)
+		}
+		return args, nil
+	}
+
+	if len(d.schema.Required) == 1 {
+		field := d.schema.Required[0]
+		if d.schema.Properties[field].Type == genai.TypeString {
+			if s, err := strconv.Unquote(input); err == nil {
+				input = s
+			}
+			return map[string]any{field: input}, nil
+		}
+	}
+	return nil, fmt.Errorf("input must be a JSON object")
+}
+
+// inputHint describes the expected input, e.g. `Input should be a JSON
+// object with fields: "city" (string, required): City to find hotels in.`
+func (d *toolDef) inputHint() string {
+	parts := make([]string, 0, len(d.fields))
+	for _, name := range d.fields {
+		p := d.schema.Properties[name]
+		attrs := []string{strings.ToLower(string(p.Type))}
+		if containsString(d.schema.Required, name) {
+			attrs = append(attrs, "required")
+		}
+		if len(p.Enum) > 0 {
+			attrs = append(attrs, "one of "+strings.Join(p.Enum, "|"))
+		}
+		part := fmt.Sprintf("%q (%s)", name, strings.Join(attrs, ", "))
+		if p.Description != "" {
+			part += ": " + strings.TrimSuffix(p.Description, ".")
+		}
+		parts = append(parts, part)
+	}
+	return "Input should be a JSON object with fields: " + strings.Join(parts, "; ") + "."
+}
+
+// ToolRegistry holds every tool the agents can use and derives the LangChain
+// tools, the genai declarations and the OpenAI-style schemas from it.
+type ToolRegistry struct {
+	defs   []*toolDef
+	byName map[string]*toolDef
+}
+
+func newToolRegistry(defs ...*toolDef) *ToolRegistry {
+	r := &ToolRegistry{byName: map[string]*toolDef{}}
+	for _, d := range defs {
+		if _, dup := r.byName[d.name]; dup {
+			panic(fmt.Sprintf("tool %s declared twice", d.name))
+		}
+		r.defs = append(r.defs, d)
+		r.byName[d.name] = d
+	}
+	return r
+}
+
+// Lookup returns the named tool, or nil.
+func (r *ToolRegistry) Lookup(name string) *toolDef {
+	return r.byName[name]
+}
+
+// LangChainTools returns the tools as tools.Tool implementations bound to
+// session, for the ReAct agent.
+func (r *ToolRegistry) LangChainTools(session Session) []tools.Tool {
+	out := make([]tools.Tool, 0, len(r.defs))
+	for _, d := range r.defs {
+		out = append(out, registeredTool{def: d, session: session})
+	}
+	return out
+}
+
+// GenaiTools returns the function declarations for the Gemini API.
+func (r *ToolRegistry) GenaiTools() []*genai.Tool {
+	decls := make([]*genai.FunctionDeclaration, 0, len(r.defs))
+	for _, d := range r.defs {
+		decls = append(decls, &genai.FunctionDeclaration{
+			Name:        d.name,
+			Description: d.description,
+			Parameters:  d.schema,
+		})
+	}
+	return []*genai.Tool{{FunctionDeclarations: decls}}
+}
+
+// OpenAITools returns OpenAI-style function tools with JSON Schema
+// parameters.
+func (r *ToolRegistry) OpenAITools() []llms.Tool {
+	out := make([]llms.Tool, 0, len(r.defs))
+	for _, d := range r.defs {
+		out = append(out, llms.Tool{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        d.name,
+				Description: d.description,
+				Parameters:  jsonSchema(d.schema),
+			},
+		})
+	}
+	return out
+}
+
+// ------------------
+// Schemas
+// ------------------
+
+// schemaFor derives a genai schema from a Go type.
+func schemaFor(t reflect.Type) (*genai.Schema, error) {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem())
+	case reflect.String:
+		return &genai.Schema{Type: genai.TypeString}, nil
+	case reflect.Bool:
+		return &genai.Schema{Type: genai.TypeBoolean}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &genai.Schema{Type: genai.TypeInteger}, nil
+	case reflect.Float32, reflect.Float64:
+		return &genai.Schema{Type: genai.TypeNumber}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &genai.Schema{Type: genai.TypeArray, Items: items}, nil
+	case reflect.Struct:
+		s := &genai.Schema{Type: genai.TypeObject, Properties: map[string]*genai.Schema{}}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, optional, ok := jsonField(f)
+			if !ok {
+				continue
+			}
+			p, err := schemaFor(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			p.Description = f.Tag.Get("desc")
+			if enum := f.Tag.Get("enum"); enum != "" {
+				p.Enum = strings.Split(enum, ",")
+			}
+			s.Properties[name] = p
+			if !optional {
+				s.Required = append(s.Required, name)
+			}
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// jsonField returns the JSON name of an exported struct field and whether it
+// is optional (omitempty); ok is false for fields JSON ignores.
+func jsonField(f reflect.StructField) (name string, optional bool, ok bool) {
+	if !f.IsExported() {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return "", false, false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, strings.Contains(opts, "omitempty"), true
+}
+
+// jsonSchema renders a genai schema as a JSON Schema object.
+func jsonSchema(s *genai.Schema) map[string]any {
+	if s == nil {
+		return map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	out := map[string]any{"type": strings.ToLower(string(s.Type))}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if s.Items != nil {
+		out["items"] = jsonSchema(s.Items)
+	}
+	if s.Type == genai.TypeObject {
+		props := map[string]any{}
+		for name, p := range s.Properties {
+			props[name] = jsonSchema(p)
+		}
+		out["properties"] = props
+		if len(s.Required) > 0 {
+			out["required"] = s.Required
+		}
+	}
+	return out
+}
+
+// validateValue checks a decoded JSON value against s: required fields
+// present, no unknown fields, and values of the declared types.
+func validateValue(s *genai.Schema, v any, path string) error {
+	label := path
+	if label == "" {
+		label = "input"
+	}
+	switch s.Type {
+	case genai.TypeObject:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", label)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("missing required field %q", joinPath(path, name))
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			if !ok {
+				return fmt.Errorf("unknown field %q", joinPath(path, k))
+			}
+			if obj[k] == nil && !containsString(s.Required, k) {
+				continue
+			}
+			if err := validateValue(prop, obj[k], joinPath(path, k)); err != nil {
+				return err
+			}
+		}
+	case genai.TypeArray:
+		items, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", label)
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				if err := validateValue(s.Items, item, fmt.Sprintf("%s[%d]", label, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case genai.TypeString:
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", label)
+		}
+		if len(s.Enum) > 0 && !containsString(s.Enum, str) {
+			return fmt.Errorf("%s must be one of %s", label, strings.Join(s.Enum, ", "))
+		}
+	case genai.TypeNumber:
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s must be a number", label)
+		}
+	case genai.TypeInteger:
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s must be an integer", label)
+		}
+	case genai.TypeBoolean:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", label)
+		}
+	}
+	return nil
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+type testAddress struct {
+	City string `json:"city" desc:"City name"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type testToolInput struct {
+	Query   string       `json:"query" desc:"What to find"`
+	Mode    string       `json:"mode,omitempty" enum:"fast,full"`
+	Limit   int          `json:"limit,omitempty"`
+	Ratio   float64      `json:"ratio,omitempty"`
+	Flag    bool         `json:"flag,omitempty"`
+	Tags    []string     `json:"tags,omitempty"`
+	Address *testAddress `json:"address,omitempty"`
+	Secret  string       `json:"-"`
+	hidden  string
+}
+
+func TestSchemaFor(t *testing.T) {
+	s, err := schemaFor(reflect.TypeFor[testToolInput]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if s.Type != genai.TypeObject || fmt.Sprint(names) != "[address flag limit mode query ratio tags]" {
+		t.Fatalf("schema = %s with %v", s.Type, names)
+	}
+	if fmt.Sprint(s.Required) != "[query]" {
+		t.Fatalf("required = %v, want [query]", s.Required)
+	}
+
+	cases := []struct {
+		field string
+		typ   genai.Type
+		desc  string
+		enum  string
+	}{
+		{"query", genai.TypeString, "What to find", "[]"},
+		{"mode", genai.TypeString, "", "[fast full]"},
+		{"limit", genai.TypeInteger, "", "[]"},
+		{"ratio", genai.TypeNumber, "", "[]"},
+		{"flag", genai.TypeBoolean, "", "[]"},
+		{"tags", genai.TypeArray, "", "[]"},
+		{"address", genai.TypeObject, "", "[]"},
+	}
+	for _, tc := range cases {
+		p := s.Properties[tc.field]
+		if p.Type != tc.typ || p.Description != tc.desc || fmt.Sprint(p.Enum) != tc.enum {
+			t.Fatalf("%s = %s %q %v, want %s %q %s", tc.field, p.Type, p.Description, p.Enum, tc.typ, tc.desc, tc.enum)
+		}
+	}
+	if items := s.Properties["tags"].Items; items == nil || items.Type != genai.TypeString {
+		t.Fatalf("tags items = %+v, want string", items)
+	}
+	addr := s.Properties["address"]
+	if fmt.Sprint(addr.Required) != "[city]" || addr.Properties["city"].Description != "City name" {
+		t.Fatalf("nested schema = %+v", addr)
+	}
+
+	if _, err := schemaFor(reflect.TypeFor[struct {
+		M map[string]int `json:"m"`
+	}]()); err == nil {
+		t.Fatalf("map field: expected error")
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	s, err := schemaFor(reflect.TypeFor[testToolInput]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		input string
+		err   string // substring of the error, "" for valid
+	}{
+		{`{"query": "x"}`, ""},
+		{`{"query": "x", "mode": "fast", "limit": 3, "ratio": 0.5, "flag": true, "tags": ["a"], "address": {"city": "Nairobi"}}`, ""},
+		// Optional fields may be null; required ones may not.
+		{`{"query": "x", "mode": null, "address": null}`, ""},
+		{`{"query": null}`, "query must be a string"},
+		{`{}`, `missing required field "query"`},
+		{`[]`, "input must be an object"},
+		{`{"query": 1}`, "query must be a string"},
+		{`{"query": "x", "extra": 1}`, `unknown field "extra"`},
+		{`{"query": "x", "mode": "slow"}`, "mode must be one of fast, full"},
+		{`{"query": "x", "limit": 2.5}`, "limit must be an integer"},
+		{`{"query": "x", "limit": "3"}`, "limit must be an integer"},
+		{`{"query": "x", "ratio": "half"}`, "ratio must be a number"},
+		{`{"query": "x", "flag": "yes"}`, "flag must be a boolean"},
+		{`{"query": "x", "tags": "a"}`, "tags must be an array"},
+		{`{"query": "x", "tags": ["a", 1]}`, "tags[1] must be a string"},
+		{`{"query": "x", "address": {}}`, `missing required field "address.city"`},
+		{`{"query": "x", "address": {"city": "N", "zip": 5}}`, "address.zip must be a string"},
+		{`{"query": "x", "address": {"city": "N", "street": "A"}}`, `unknown field "address.street"`},
+	}
+	for _, tc := range cases {
+		var v any
+		if err := json.Unmarshal([]byte(tc.input), &v); err != nil {
+			t.Fatal(err)
+		}
+		err := validateValue(s, v, "")
+		switch {
+		case tc.err == "" && err != nil:
+			t.Fatalf("%s: unexpected error %v", tc.input, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Fatalf("%s: error = %v, want %q", tc.input, err, tc.err)
+		}
+	}
+}
+
+func TestToolParseInput(t *testing.T) {
+	type cityInput struct {
+		City  string `json:"city"`
+		Stars int    `json:"stars,omitempty"`
+	}
+	type routeInput struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	type countInput struct {
+		N int `json:"n"`
+	}
+	echo := func(ctx context.Context, session Session, in cityInput) (any, error) { return in, nil }
+	city := defineTool("city", "", echo)
+	route := defineTool("route", "", func(ctx context.Context, session Session, in routeInput) (any, error) { return in, nil })
+	count := defineTool("count", "", func(ctx context.Context, session Session, in countInput) (any, error) { return in, nil })
+
+	cases := []struct {
+		tool  *toolDef
+		input string
+		want  string // args as JSON, "" for an error
+	}{
+		{city, `{"city": "Nairobi", "stars": 4}`, `{"city":"Nairobi","stars":4}`},
+		// A single required string field takes the bare value, quoted or not.
+		{city, `Nairobi`, `{"city":"Nairobi"}`},
+		{city, ` "Nairobi, Kenya" `, `{"city":"Nairobi, Kenya"}`},
+		{city, `{"city": `, ""},
+		{route, `Nairobi`, ""},
+		{count, `3`, ""},
+	}
+	for _, tc := range cases {
+		args, err := tc.tool.parseInput(tc.input)
+		if tc.want == "" {
+			if err == nil {
+				t.Fatalf("%s(%q): expected error, got %v", tc.tool.name, tc.input, args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s(%q): %v", tc.tool.name, tc.input, err)
+		}
+		if got, _ := json.Marshal(args); string(got) != tc.want {
+			t.Fatalf("%s(%q) = %s, want %s", tc.tool.name, tc.input, got, tc.want)
+		}
+	}
+
+	ctx := context.Background()
+	if got := city.run(ctx, Session{}, "Nairobi"); got != `{"city":"Nairobi"}` {
+		t.Fatalf("run = %s", got)
+	}
+	if got := city.run(ctx, Session{}, `{"stars": 4}`); !strings.HasPrefix(got, "Error: invalid input for city: missing required field \"city\"") || !strings.Contains(got, `"city" (string, required)`) {
+		t.Fatalf("run with missing field = %s", got)
+	}
+}
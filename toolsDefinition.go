@@ -1,89 +1,184 @@
 package main
 
 import (
-	"google.golang.org/genai"
+	"context"
+	"errors"
+	"fmt"
 )
 
 // ------------------
 // Tool Logic
 // ------------------
 
-func getFlightSchedule(origin, destination string) map[string]interface{} {
-	return map[string]interface{}{
-		"origin":            origin,
-		"destination":       destination,
-		"flight_time_hours": 5.5,
-		"price_usd":         920,
+func getFlightSchedule(ctx context.Context, origin, destination, date string) (map[string]interface{}, error) {
+	if flightProvider == nil {
+		return nil, errors.New("flight data is not available (check FLIGHT_DATA_PATH)")
 	}
+	day, err := parseDate(date)
+	if err != nil {
+		return nil, err
+	}
+	options, err := flightProvider.SearchFlights(ctx, FlightQuery{Origin: origin, Destination: destination, Date: day})
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"origin":      origin,
+		"destination": destination,
+		"options":     append([]FlightOption{}, options...),
+	}
+	if date != "" {
+		result["date"] = date
+	}
+	if len(options) == 0 {
+		result["message"] = "No scheduled flights found for this route."
+	}
+	return result, nil
 }
 
-func getHotelSchedule(city string) map[string]interface{} {
-	return map[string]interface{}{
-		"city": city,
-		"hotels": []map[string]interface{}{
-			{
-				"name":      "Nairobi Serena",
-				"price_usd": 250,
-			},
-			{
-				"name":      "Radisson Blu",
-				"price_usd": 200,
-			},
-		},
+func getHotelSchedule(ctx context.Context, in hotelScheduleInput) (map[string]interface{}, error) {
+	if hotelProvider == nil {
+		return nil, errors.New("hotel data is not available (check HOTEL_DATA_PATH)")
+	}
+	checkIn, checkOut, err := parseStay(in.CheckIn, in.CheckOut)
+	if err != nil {
+		return nil, err
+	}
+	if in.MinStars < 0 || in.MinStars > 5 {
+		return nil, fmt.Errorf("min_stars must be between 1 and 5, or 0 for no filter, got %d", in.MinStars)
 	}
+	q := HotelQuery{
+		City:          in.City,
+		CheckIn:       checkIn,
+		CheckOut:      checkOut,
+		Guests:        in.Guests,
+		MaxNightlyUSD: in.MaxPriceUSD,
+		MinStars:      in.MinStars,
+		Amenities:     in.Amenities,
+	}
+	hotels, err := hotelProvider.SearchHotels(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"city":   in.City,
+		"guests": max(in.Guests, 1),
+		"hotels": append([]HotelOption{}, hotels...),
+	}
+	if n := q.Nights(); n > 0 {
+		result["check_in"] = in.CheckIn
+		result["check_out"] = in.CheckOut
+		result["nights"] = n
+	}
+	if len(hotels) == 0 {
+		result["message"] = "No hotels match these criteria."
+	}
+	return result, nil
 }
 
-func convertCurrency(amount float64, from, to string) map[string]interface{} {
-	rate := 925.0
-	return map[string]interface{}{
-		"amount_converted": amount * rate,
-		"currency":         to,
+func convertCurrency(amount float64, from, to string) (Conversion, error) {
+	if currencyRates == nil {
+		return Conversion{}, errors.New("exchange rates are not available (check RATES_PATH)")
 	}
+	return currencyRates.Convert(amount, from, to)
+}
+
+func planTripFromInput(ctx context.Context, in planTripInput) (*TripPlan, error) {
+	depart, err := parseDate(in.DepartDate)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := parseDate(in.ReturnDate)
+	if err != nil {
+		return nil, err
+	}
+	return planTrip(ctx, TripRequest{
+		Origin:           in.Origin,
+		Destination:      in.Destination,
+		DepartDate:       depart,
+		ReturnDate:       ret,
+		Nights:           in.Nights,
+		Travellers:       in.Travellers,
+		HomeCurrency:     in.HomeCurrency,
+		MaxHotelPriceUSD: in.MaxHotelPriceUSD,
+		MinStars:         in.MinStars,
+	})
 }
 
 // ------------------
 // Tool Definitions
 // ------------------
 
-var genAiTools = []*genai.Tool{
-	{
-		FunctionDeclarations: []*genai.FunctionDeclaration{
-			{
-				Name:        "get_flight_schedule",
-				Description: "Return a flight schedule option from origin to destination with duration and USD price.",
-				Parameters: &genai.Schema{
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
-						"origin":      {Type: genai.TypeString},
-						"destination": {Type: genai.TypeString},
-					},
-					Required: []string{"origin", "destination"},
-				},
-			},
-			{
-				Name:        "get_hotel_schedule",
-				Description: "Return hotel options in a city with nightly USD prices.",
-				Parameters: &genai.Schema{
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
-						"city": {Type: genai.TypeString},
-					},
-					Required: []string{"city"},
-				},
-			},
-			{
-				Name:        "convert_currency",
-				Description: "Convert currency amount from one currency to another.",
-				Parameters: &genai.Schema{
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
-						"amount": {Type: genai.TypeNumber},
-						"from":   {Type: genai.TypeString},
-						"to":     {Type: genai.TypeString},
-					},
-					Required: []string{"amount", "from", "to"},
-				},
-			},
-		},
-	},
+type flightScheduleInput struct {
+	Origin      string `json:"origin" desc:"Departure city or airport code."`
+	Destination string `json:"destination" desc:"Arrival city or airport code."`
+	Date        string `json:"date,omitempty" desc:"Departure date as YYYY-MM-DD; omit to list every scheduled option."`
+}
+
+type hotelScheduleInput struct {
+	City        string   `json:"city" desc:"City to find hotels in."`
+	CheckIn     string   `json:"check_in,omitempty" desc:"Check-in date as YYYY-MM-DD; give with check_out to get total stay cost and availability."`
+	CheckOut    string   `json:"check_out,omitempty" desc:"Check-out date as YYYY-MM-DD."`
+	Guests      int      `json:"guests,omitempty" desc:"Number of guests (default 1)."`
+	MaxPriceUSD float64  `json:"max_price_usd,omitempty" desc:"Maximum nightly price per room in USD."`
+	MinStars    int      `json:"min_stars,omitempty" desc:"Minimum star rating, 1-5; omit or 0 for no filter."`
+	Amenities   []string `json:"amenities,omitempty" desc:"Amenities every hotel must have, e.g. wifi, pool, gym, airport_shuttle."`
+}
+
+type convertCurrencyInput struct {
+	Amount float64 `json:"amount" desc:"Amount to convert."`
+	From   string  `json:"from" desc:"ISO 4217 code of the source currency, e.g. USD."`
+	To     string  `json:"to" desc:"ISO 4217 code of the target currency, e.g. NGN."`
 }
+
+type planTripInput struct {
+	Origin           string  `json:"origin" desc:"Departure city or airport code."`
+	Destination      string  `json:"destination" desc:"Destination city or airport code."`
+	DepartDate       string  `json:"depart_date" desc:"Outbound date as YYYY-MM-DD."`
+	ReturnDate       string  `json:"return_date,omitempty" desc:"Return date as YYYY-MM-DD; give this or nights. If both are given they must agree."`
+	Nights           int     `json:"nights,omitempty" desc:"Number of nights at the destination; give this or return_date."`
+	Travellers       int     `json:"travellers,omitempty" desc:"Number of travellers (default 1)."`
+	HomeCurrency     string  `json:"home_currency,omitempty" desc:"ISO 4217 code to report the total in, e.g. NGN (default USD)."`
+	MaxHotelPriceUSD float64 `json:"max_hotel_price_usd,omitempty" desc:"Maximum nightly hotel price per room in USD."`
+	MinStars         int     `json:"min_stars,omitempty" desc:"Minimum hotel star rating, 1-5; omit or 0 for no filter."`
+}
+
+type internalKnowledgeInput struct {
+	Query string `json:"query" desc:"What to search for."`
+}
+
+// agentToolRegistry declares every tool once. The LangChain tools, the
+// Gemini declarations, the OpenAI JSON schemas and input validation are all
+// derived from it.
+var agentToolRegistry = newToolRegistry(
+	defineTool("get_flight_schedule",
+		"Return the flight options from origin to destination, cheapest first, with carrier, flight number, departure and arrival times, duration, stops, fare class and USD price.",
+		func(ctx context.Context, _ Session, in flightScheduleInput) (any, error) {
+			return getFlightSchedule(ctx, in.Origin, in.Destination, in.Date)
+		}),
+	defineTool("get_hotel_schedule",
+		"Return available hotels in a city, cheapest first, with star rating, amenities, nightly USD price, rooms needed for the party and total stay cost when dates are given.",
+		func(ctx context.Context, _ Session, in hotelScheduleInput) (any, error) {
+			return getHotelSchedule(ctx, in)
+		}),
+	defineTool("convert_currency",
+		"Convert an amount from one currency to another, returning the converted amount rounded to the currency's minor unit, the rate used and its as-of date.",
+		func(ctx context.Context, _ Session, in convertCurrencyInput) (any, error) {
+			return convertCurrency(in.Amount, in.From, in.To)
+		}),
+	defineTool("plan_trip",
+		"Plan a round trip in one step: finds the cheapest outbound and return flights and hotel for the dates and returns a budget breakdown with the total in USD and in the home currency. Prefer this over calling the flight, hotel and currency tools separately when the user wants a whole trip.",
+		func(ctx context.Context, _ Session, in planTripInput) (any, error) {
+			return planTripFromInput(ctx, in)
+		}),
+	defineTool("query_internal_knowledge",
+		"Query the internal knowledge base for information from documents and previous conversations.",
+		func(ctx context.Context, session Session, in internalKnowledgeInput) (any, error) {
+			return queryInternalKnowledge(ctx, session, in.Query)
+		}),
+)
+
+// genAiTools holds the Gemini function declarations for the registered tools.
+var genAiTools = agentToolRegistry.GenaiTools()
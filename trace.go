@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// runTrace collects what happened during one agent run. It travels in the
+// context handed to the agent, so tools can record into it without globals.
+type runTrace struct {
+	mu      sync.Mutex
+	sources []Retrieved
+	tools   []string
+}
+
+type runTraceKey struct{}
+
+func withRunTrace(ctx context.Context) (context.Context, *runTrace) {
+	t := &runTrace{}
+	return context.WithValue(ctx, runTraceKey{}, t), t
+}
+
+// traceFrom returns the trace carried by ctx, or nil.
+func traceFrom(ctx context.Context) *runTrace {
+	t, _ := ctx.Value(runTraceKey{}).(*runTrace)
+	return t
+}
+
+func (t *runTrace) addSources(rs ...Retrieved) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sources = append(t.sources, rs...)
+}
+
+// SourceIDs returns the IDs of the chunks retrieved during the run.
+func (t *runTrace) SourceIDs() []string {
+	ids := []string{}
+	for _, r := range t.Sources() {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+// Sources returns the chunks retrieved during the run, in retrieval order.
+func (t *runTrace) Sources() []Retrieved {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Retrieved(nil), t.sources...)
+}
+
+func (t *runTrace) addToolCall(name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tools = append(t.tools, name)
+}
+
+// Tools returns the names of the tools called during the run, in call
+// order, including calls rejected for invalid input.
+func (t *runTrace) Tools() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string{}, t.tools...)
+}
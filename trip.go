@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// TripRequest describes a round trip to plan. Either ReturnDate or Nights
+// sets the length of the stay; if both are set they must agree.
+type TripRequest struct {
+	Origin           string
+	Destination      string
+	DepartDate       time.Time
+	ReturnDate       time.Time
+	Nights           int
+	Travellers       int
+	HomeCurrency     string
+	MaxHotelPriceUSD float64
+	MinStars         int
+}
+
+// TripPlan is the budget for a round trip: the cheapest outbound and return
+// flights and hotel that fit, and what they cost in USD and in the
+// traveller's home currency.
+type TripPlan struct {
+	Origin         string         `json:"origin"`
+	Destination    string         `json:"destination"`
+	DepartDate     string         `json:"depart_date"`
+	ReturnDate     string         `json:"return_date"`
+	Nights         int            `json:"nights"`
+	Travellers     int            `json:"travellers"`
+	HomeCurrency   string         `json:"home_currency"`
+	OutboundFlight *FlightOption  `json:"outbound_flight"`
+	ReturnFlight   *FlightOption  `json:"return_flight"`
+	Hotel          *HotelOption   `json:"hotel"`
+	Breakdown      []TripCostLine `json:"breakdown"`
+	TotalUSD       float64        `json:"total_usd"`
+	TotalHome      float64        `json:"total_home"`
+	Rate           float64        `json:"usd_to_home_rate"`
+	RatesAsOf      string         `json:"rates_as_of,omitempty"`
+	Notes          []string       `json:"notes,omitempty"`
+}
+
+// TripCostLine is one item of a trip budget.
+type TripCostLine struct {
+	Item   string  `json:"item"`
+	Detail string  `json:"detail"`
+	USD    float64 `json:"usd"`
+	Home   float64 `json:"home"`
+}
+
+// planTrip prices a round trip with the flight, hotel and currency providers.
+// Parts that cannot be found (no flight that day, no hotel left) are left
+// out of the total and explained in Notes rather than failing the plan.
+func planTrip(ctx context.Context, req TripRequest) (*TripPlan, error) {
+	if req.DepartDate.IsZero() {
+		return nil, errors.New("depart_date is required")
+	}
+	returnDate := req.ReturnDate
+	if returnDate.IsZero() {
+		if req.Nights <= 0 {
+			return nil, errors.New("give either return_date or nights")
+		}
+		returnDate = req.DepartDate.AddDate(0, 0, req.Nights)
+	}
+	if !returnDate.After(req.DepartDate) {
+		return nil, errors.New("return_date must be after depart_date")
+	}
+	if nights := int(returnDate.Sub(req.DepartDate).Hours() / 24); req.Nights != 0 && req.Nights != nights {
+		return nil, fmt.Errorf("nights is %d but return_date is %d nights after depart_date; give one or make them agree", req.Nights, nights)
+	}
+	if req.MinStars < 0 || req.MinStars > 5 {
+		return nil, fmt.Errorf("min_stars must be between 1 and 5, or 0 for no filter, got %d", req.MinStars)
+	}
+	travellers := max(req.Travellers, 1)
+	home := req.HomeCurrency
+	if home == "" {
+		home = "USD"
+	}
+	home, err := normalizeCurrency(home)
+	if err != nil {
+		return nil, err
+	}
+	if currencyRates == nil {
+		return nil, errors.New("exchange rates are not available (check RATES_PATH)")
+	}
+	usdToHome, err := currencyRates.Rate("USD", home)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &TripPlan{
+		Origin:       req.Origin,
+		Destination:  req.Destination,
+		DepartDate:   req.DepartDate.Format(dateLayout),
+		ReturnDate:   returnDate.Format(dateLayout),
+		Nights:       int(returnDate.Sub(req.DepartDate).Hours() / 24),
+		Travellers:   travellers,
+		HomeCurrency: home,
+		Rate:         math.Round(usdToHome*1e6) / 1e6,
+		RatesAsOf:    currencyRates.AsOf.Format(dateLayout),
+	}
+	addLine := func(item, detail string, usd float64) {
+		usd = roundToMinorUnit(usd, "USD")
+		plan.Breakdown = append(plan.Breakdown, TripCostLine{
+			Item:   item,
+			Detail: detail,
+			USD:    usd,
+			Home:   roundToMinorUnit(usd*usdToHome, home),
+		})
+		plan.TotalUSD += usd
+	}
+
+	// Flights: the cheapest option each way, priced per traveller.
+	if flightProvider == nil {
+		plan.Notes = append(plan.Notes, "Flight data is not available; flights are not included.")
+	} else {
+		legs := []struct {
+			item     string
+			from, to string
+			date     time.Time
+			dst      **FlightOption
+		}{
+			{"outbound_flight", req.Origin, req.Destination, req.DepartDate, &plan.OutboundFlight},
+			{"return_flight", req.Destination, req.Origin, returnDate, &plan.ReturnFlight},
+		}
+		for _, leg := range legs {
+			options, err := flightProvider.SearchFlights(ctx, FlightQuery{Origin: leg.from, Destination: leg.to, Date: leg.date})
+			if err != nil {
+				return nil, err
+			}
+			if len(options) == 0 {
+				plan.Notes = append(plan.Notes, fmt.Sprintf("No flight from %s to %s on %s; %s is not included.", leg.from, leg.to, leg.date.Format(dateLayout), strings.ReplaceAll(leg.item, "_", " ")))
+				continue
+			}
+			f := options[0]
+			*leg.dst = &f
+			addLine(leg.item, fmt.Sprintf("%s %s %s, $%.2f x %d traveller(s)", f.Carrier, f.FlightNumber, f.Departure, f.PriceUSD, travellers), f.PriceUSD*float64(travellers))
+		}
+	}
+
+	// Hotel: the cheapest one with rooms for the whole stay. Flights name the
+	// destination city, which is what the hotel catalog is keyed by.
+	city := req.Destination
+	if plan.OutboundFlight != nil && plan.OutboundFlight.DestinationCity != "" {
+		city = plan.OutboundFlight.DestinationCity
+	}
+	if hotelProvider == nil {
+		plan.Notes = append(plan.Notes, "Hotel data is not available; accommodation is not included.")
+	} else {
+		hotels, err := hotelProvider.SearchHotels(ctx, HotelQuery{
+			City:          city,
+			CheckIn:       req.DepartDate,
+			CheckOut:      returnDate,
+			Guests:        travellers,
+			MaxNightlyUSD: req.MaxHotelPriceUSD,
+			MinStars:      req.MinStars,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(hotels) == 0 {
+			plan.Notes = append(plan.Notes, fmt.Sprintf("No hotel in %s matches for these dates; accommodation is not included.", city))
+		} else {
+			h := hotels[0]
+			plan.Hotel = &h
+			addLine("hotel", fmt.Sprintf("%s, $%.2f/night x %d night(s) x %d room(s)", h.Name, h.NightlyUSD, h.Nights, h.Rooms), h.TotalUSD)
+		}
+	}
+
+	plan.TotalUSD = roundToMinorUnit(plan.TotalUSD, "USD")
+	plan.TotalHome = roundToMinorUnit(plan.TotalUSD*usdToHome, home)
+	return plan, nil
+}
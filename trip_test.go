@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanTripStayLength(t *testing.T) {
+	savedRates, savedFlights, savedHotels := currencyRates, flightProvider, hotelProvider
+	defer func() { currencyRates, flightProvider, hotelProvider = savedRates, savedFlights, savedHotels }()
+	currencyRates = &RateTable{Base: "USD", Rates: map[string]float64{"USD": 1}}
+	flightProvider, hotelProvider = nil, nil
+
+	depart := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name   string
+		ret    time.Time
+		nights int
+		want   int    // nights planned
+		err    string // substring of the error, "" for valid
+	}{
+		{name: "nights only", nights: 4, want: 4},
+		{name: "return date only", ret: depart.AddDate(0, 0, 3), want: 3},
+		{name: "both agree", ret: depart.AddDate(0, 0, 3), nights: 3, want: 3},
+		{name: "both disagree", ret: depart.AddDate(0, 0, 3), nights: 5, err: "nights is 5 but return_date is 3 nights"},
+		{name: "neither", err: "give either return_date or nights"},
+		{name: "return before depart", ret: depart, nights: 0, err: "return_date must be after depart_date"},
+	}
+	for _, tc := range cases {
+		plan, err := planTrip(context.Background(), TripRequest{
+			Origin: "LOS", Destination: "NBO", DepartDate: depart, ReturnDate: tc.ret, Nights: tc.nights,
+		})
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("%s: error = %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if plan.Nights != tc.want {
+			t.Fatalf("%s: nights = %d, want %d", tc.name, plan.Nights, tc.want)
+		}
+	}
+}